@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required" example:"nightly-report"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1" example:"users:read"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2030-01-01T00:00:00Z"`
+}
+
+// CreateAPIKeyResponse represents a newly created API key
+type CreateAPIKeyResponse struct {
+	Key     string        `json:"key" example:"sra_Xq3d9LkP..."`
+	APIKey  models.APIKey `json:"api_key"`
+	Message string        `json:"message" example:"Store this key now, it will not be shown again"`
+}
+
+// CreateAPIKey creates a new API key
+// @Summary Create API key
+// @Description Create an API key for service-to-service access (admin only). The key is returned only once.
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param api_key body CreateAPIKeyRequest true "API key data"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to create API key"
+// @Router /admin/api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	// Validate requested scopes
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidScope, "Invalid scope: "+scope))
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidExpiry, "expires_at must be in the future"))
+		return
+	}
+
+	// Generate key; only its hash is stored
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to generate API key", nil))
+		return
+	}
+
+	apiKey := models.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    req.Scopes,
+		CreatedBy: c.GetInt("user_id"),
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	err = apiKey.Create(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to create API key", nil))
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{
+		Key:     key,
+		APIKey:  apiKey,
+		Message: "Store this key now, it will not be shown again",
+	})
+}
+
+// GetAPIKeys lists all API keys
+// @Summary List API keys
+// @Description List all API keys with their usage and revocation status (admin only)
+// @Tags API Keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of API keys"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to retrieve API keys"
+// @Router /admin/api-keys [get]
+func GetAPIKeys(c *gin.Context) {
+	keys, err := models.GetAllAPIKeys(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve API keys", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+// RevokeAPIKey revokes an API key
+// @Summary Revoke API key
+// @Description Revoke an API key so it can no longer be used (admin only)
+// @Tags API Keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]interface{} "API key revoked successfully"
+// @Failure 400 {object} utils.Problem "Invalid API key ID"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "API key not found"
+// @Router /admin/api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	// Get API key ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid API key ID"))
+		return
+	}
+
+	err = models.RevokeAPIKey(c.Request.Context(), id)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to revoke API key", utils.NewAPIError(http.StatusNotFound, utils.CodeAPIKeyNotFound, "API key not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked successfully",
+	})
+}
@@ -1,17 +1,20 @@
 package controllers
 
 import (
+	"context"
 	"net/http"
 	"simple-restful-api/models"
 	"simple-restful-api/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // LoginRequest represents the login request body
 type LoginRequest struct {
-	Username string `json:"username" binding:"required" example:"darkpiaro"`
-	Password string `json:"password" binding:"required" example:"password123"`
+	Username    string `json:"username" binding:"required" example:"darkpiaro"`
+	Password    string `json:"password" binding:"required" example:"BlueHarbor42"`
+	DeviceLabel string `json:"device_label" example:"Work laptop"` // optional, derived from User-Agent when empty
 }
 
 // LoginResponse represents the login response
@@ -21,54 +24,184 @@ type LoginResponse struct {
 	Message string      `json:"message" example:"Login successful"`
 }
 
+// MFAChallengeResponse is returned by Login when the user must also provide a TOTP code
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required" example:"true"`
+	MFAToken    string `json:"mfa_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Message     string `json:"message" example:"MFA code required"`
+}
+
+// LoginMFARequest represents the second step of a two-step login
+type LoginMFARequest struct {
+	MFAToken    string `json:"mfa_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Code        string `json:"code" binding:"required" example:"123456"`
+	DeviceLabel string `json:"device_label" example:"Work laptop"` // optional, derived from User-Agent when empty
+}
+
 // Login handles user authentication
 // @Summary User Login
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return JWT token. When MFA is enabled an MFA challenge token is returned instead; exchange it at /login/mfa.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param login body LoginRequest true "Login credentials"
 // @Success 200 {object} LoginResponse
-// @Failure 400 {object} map[string]interface{} "Invalid request format"
-// @Failure 401 {object} map[string]interface{} "Invalid username or password"
-// @Failure 500 {object} map[string]interface{} "Failed to generate token"
+// @Success 202 {object} MFAChallengeResponse
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Failure 401 {object} utils.Problem "Invalid username or password"
+// @Failure 403 {object} utils.Problem "Email address not verified"
+// @Failure 429 {object} utils.Problem "Too many failed login attempts"
+// @Failure 500 {object} utils.Problem "Failed to generate token"
+// @Failure 503 {object} utils.Problem "Authentication service unavailable"
 // @Router /login [post]
 func Login(c *gin.Context) {
 	var loginReq LoginRequest
 
 	// Bind JSON request body
 	if err := c.ShouldBindJSON(&loginReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	// Reject locked-out usernames and clients before doing any password work
+	if !checkLoginAllowed(c, loginReq.Username) {
+		return
+	}
+
+	// Check the password with the configured authenticator chain
+	user, err := authenticatePassword(c.Request.Context(), loginReq.Username, loginReq.Password)
+	if err == errAuthUnavailable {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusServiceUnavailable, utils.CodeServiceUnavailable, "Authentication service unavailable"))
+		return
+	}
+	if err != nil {
+		recordLoginFailure(c, loginReq.Username)
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidCredentials, "Invalid username or password"))
+		return
+	}
+
+	// Optionally require a verified email address before allowing login
+	if blockedByEmailVerification(user) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeEmailNotVerified, "Email address not verified"))
+		return
+	}
+
+	// Users with MFA must complete a second step before receiving an access token
+	if user.MFAEnabled {
+		respondWithMFAChallenge(c, user)
+		return
+	}
+
+	respondWithToken(c, user, loginReq.DeviceLabel)
+}
+
+// LoginMFA completes a two-step login
+// @Summary User Login (MFA step)
+// @Description Exchange an MFA challenge token and a TOTP code for a JWT token
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param login body LoginMFARequest true "MFA challenge token and TOTP code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Failure 401 {object} utils.Problem "Invalid or expired MFA token or code"
+// @Failure 429 {object} utils.Problem "Too many failed login attempts"
+// @Failure 500 {object} utils.Problem "Failed to generate token"
+// @Failure 503 {object} utils.Problem "Database unavailable"
+// @Router /login/mfa [post]
+func LoginMFA(c *gin.Context) {
+	var req LoginMFARequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	// Validate MFA challenge token from the first step
+	claims, err := utils.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidMFAToken, "Invalid or expired MFA token"))
+		return
+	}
+
+	// A missing user means the token is stale; a database failure is reported as such
+	state, err := models.GetMFAState(c.Request.Context(), claims.UserID)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to load MFA settings",
+			utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidMFAToken, "Invalid or expired MFA token")))
+		return
+	}
+	if !state.Enabled {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidMFAToken, "Invalid or expired MFA token"))
+		return
+	}
+
+	// MFA codes are throttled together with passwords
+	if !checkLoginAllowed(c, claims.Username) {
+		return
+	}
+
+	if !verifyMFACode(c, claims.UserID, state.Secret, req.Code) {
+		recordLoginFailure(c, claims.Username)
 		return
 	}
 
-	// Get user from database
-	user, err := models.GetUserByUsername(loginReq.Username)
+	user, err := models.GetUserByID(c.Request.Context(), claims.UserID)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid username or password",
-		})
+		utils.AbortWithError(c, modelError(err, "Failed to load user",
+			utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidMFAToken, "Invalid or expired MFA token")))
 		return
 	}
 
-	// Validate password
-	err = user.ValidatePassword(loginReq.Password)
+	respondWithToken(c, user, req.DeviceLabel)
+}
+
+// rehashPassword stores a new hash of a verified password using the current hasher.
+// Failures are logged only, since the login itself already succeeded.
+func rehashPassword(ctx context.Context, userID int, password string) {
+	hash, err := utils.HashPassword(ctx, password)
+	if err == nil {
+		err = models.UpdatePasswordHash(ctx, userID, hash)
+	}
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to upgrade password hash", "user_id", userID, "error", err)
+	}
+}
+
+// respondWithMFAChallenge sends the token needed to complete login at /login/mfa
+func respondWithMFAChallenge(c *gin.Context, user *models.User) {
+	mfaToken, err := utils.GenerateMFAToken(user.ID, user.Username)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid username or password",
-		})
+		utils.AbortWithError(c, utils.InternalError("Failed to generate token", nil))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		Message:     "MFA code required",
+	})
+}
+
+// respondWithToken starts a session for an authenticated user, issues an access
+// token tied to it and sends the login response
+func respondWithToken(c *gin.Context, user *models.User, deviceLabel string) {
+	// A completed login resets the username's failure counter
+	utils.LoginAttempts.WithLabelValues("success").Inc()
+	clearLoginFailures(c.Request.Context(), user.Username)
+
+	// Record the session so the user can see and revoke it later
+	session, err := startSession(c, user.ID, deviceLabel, utils.AccessTokenTTL)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to create session", nil))
 		return
 	}
 
 	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Username)
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Role, session.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to generate token",
-		})
+		utils.AbortWithError(c, utils.InternalError("Failed to generate token", nil))
 		return
 	}
 
@@ -84,3 +217,29 @@ func Login(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// startSession records a new login session for a user on the requesting device.
+// The device label is derived from the User-Agent header when empty.
+func startSession(c *gin.Context, userID int, deviceLabel string, ttl time.Duration) (*models.Session, error) {
+	sessionID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	if deviceLabel == "" {
+		deviceLabel = utils.DeviceLabelFromUserAgent(c.Request.UserAgent())
+	}
+
+	session := models.Session{
+		ID:          sessionID,
+		UserID:      userID,
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		DeviceLabel: deviceLabel,
+	}
+	err = session.Create(c.Request.Context(), ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
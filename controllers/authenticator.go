@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strings"
+)
+
+var (
+	// errInvalidCredentials means no authenticator in the chain accepted the password
+	errInvalidCredentials = errors.New("invalid username or password")
+
+	// errAuthUnavailable means the password could not be checked because a
+	// backend such as the database or the LDAP server was unreachable
+	errAuthUnavailable = errors.New("authentication backend unavailable")
+)
+
+// authenticatePassword checks a username and password with each authenticator
+// listed in AUTH_CHAIN ("local", "ldap"), in order, and returns the first
+// user that is accepted
+func authenticatePassword(ctx context.Context, username string, password string) (*models.User, error) {
+	unavailable := false
+
+	for _, name := range strings.Split(utils.GetEnv("AUTH_CHAIN", "local"), ",") {
+		var user *models.User
+		var err error
+
+		switch strings.TrimSpace(name) {
+		case "local":
+			user, err = authenticateLocal(ctx, username, password)
+		case "ldap":
+			user, err = authenticateLDAP(ctx, username, password)
+		default:
+			utils.Logger(ctx).Warn("Unknown authenticator in AUTH_CHAIN", "authenticator", name)
+			continue
+		}
+
+		if err == nil {
+			return user, nil
+		}
+		if errors.Is(err, errAuthUnavailable) {
+			unavailable = true
+		}
+	}
+
+	if unavailable {
+		return nil, errAuthUnavailable
+	}
+	return nil, errInvalidCredentials
+}
+
+// authenticateLocal checks the password stored in the users table. Directory
+// users are skipped because their password lives in LDAP.
+func authenticateLocal(ctx context.Context, username string, password string) (*models.User, error) {
+	user, err := models.GetUserByUsername(ctx, username)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		// A database failure says nothing about the password, so it must not count as a failed login
+		utils.Logger(ctx).Error("Failed to look up user", "error", err)
+		return nil, errAuthUnavailable
+	}
+	if err != nil || user.AuthSource == models.AuthSourceLDAP {
+		// Spend the same time as a real comparison so unknown usernames are not revealed
+		models.CompareDummyPassword(ctx, password)
+		return nil, errInvalidCredentials
+	}
+
+	if err := user.ValidatePassword(ctx, password); err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	// Transparently upgrade hashes that use a weaker algorithm or outdated parameters
+	if user.PasswordNeedsRehash() {
+		rehashPassword(ctx, user.ID, password)
+	}
+
+	// Optionally flag passwords that have appeared in a breach since they were set
+	if !user.PasswordBreached && utils.GetEnvBool("BREACHED_PASSWORD_CHECK_ON_LOGIN", false) {
+		flagBreachedPassword(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+// flagBreachedPassword marks the user's password as breached when it is found in
+// the breach corpus, so clients can ask the user to change it
+func flagBreachedPassword(ctx context.Context, user *models.User, password string) {
+	minCount := utils.GetPasswordPolicy().BreachedMinCount
+	if minCount <= 0 || utils.BreachedPasswordCount(password) < minCount {
+		return
+	}
+
+	if err := models.SetPasswordBreached(ctx, user.ID, true); err != nil {
+		utils.Logger(ctx).Error("Failed to flag breached password", "error", err)
+		return
+	}
+	user.PasswordBreached = true
+
+	entry := models.AuditLog{
+		Event:   models.AuditPasswordBreached,
+		ActorID: user.ID,
+		Actor:   user.Username,
+		Target:  fmt.Sprintf("user:%d", user.ID),
+	}
+	if err := entry.Create(ctx); err != nil {
+		utils.Logger(ctx).Error("Failed to write audit log", "error", err)
+	}
+}
+
+// authenticateLDAP checks the password against the directory and creates or
+// refreshes the user's local shadow record
+func authenticateLDAP(ctx context.Context, username string, password string) (*models.User, error) {
+	cfg := utils.GetLDAPConfig()
+
+	entry, err := utils.LDAPAuthenticate(cfg, username, password)
+	if err != nil {
+		if errors.Is(err, utils.ErrLDAPInvalidCredentials) {
+			return nil, errInvalidCredentials
+		}
+		utils.Logger(ctx).Error("LDAP authentication failed", "error", err)
+		return nil, errAuthUnavailable
+	}
+
+	// Directory users never log in with a local password, so a new shadow record
+	// gets a random one. Existing records keep theirs, which saves a hash per login.
+	hash := ""
+	_, err = models.GetUserByUsername(ctx, entry.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		random, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return nil, errAuthUnavailable
+		}
+		hash, err = utils.HashPassword(ctx, random)
+		if err != nil {
+			return nil, errAuthUnavailable
+		}
+	} else if err != nil {
+		utils.Logger(ctx).Error("Failed to look up LDAP user", "username", entry.Username, "error", err)
+		return nil, errAuthUnavailable
+	}
+
+	fullName := entry.FullName
+	if fullName == "" {
+		fullName = entry.Username
+	}
+	user := &models.User{
+		Username: entry.Username,
+		FullName: fullName,
+		Email:    entry.Email,
+	}
+
+	// Roles follow group membership only when a mapping is configured
+	syncRole := len(cfg.GroupRoles) > 0
+	if syncRole {
+		user.Role = cfg.RoleForGroups(entry.Groups, models.RoleAdmin, models.RoleUser)
+	}
+
+	err = models.UpsertLDAPUser(ctx, user, hash, syncRole)
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to save LDAP user", "username", entry.Username, "error", err)
+		if errors.Is(err, models.ErrUnavailable) {
+			return nil, errAuthUnavailable
+		}
+		return nil, errInvalidCredentials
+	}
+
+	return user, nil
+}
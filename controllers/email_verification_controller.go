@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResendVerificationRequest represents a request to resend the verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// verifiedEmailRequired reports whether ALLOW_UNVERIFIED_LOGIN=false requires a
+// verified email address before login
+func verifiedEmailRequired() bool {
+	return !utils.GetEnvBool("ALLOW_UNVERIFIED_LOGIN", true)
+}
+
+// blockedByEmailVerification reports whether the user must verify their email
+// address before logging in. Accounts without an address have nothing to verify,
+// so they are let through rather than locked out.
+func blockedByEmailVerification(user *models.User) bool {
+	return verifiedEmailRequired() && user.Email != "" && !user.EmailVerified
+}
+
+// VerifyEmail confirms a user's email address
+// @Summary Verify email address
+// @Description Verify an email address using the signed link sent at signup
+// @Tags Authentication
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} map[string]interface{} "Email verified successfully"
+// @Failure 400 {object} utils.Problem "Invalid or expired verification link"
+// @Router /verify-email [get]
+func VerifyEmail(c *gin.Context) {
+	claims, err := utils.ValidateEmailVerificationToken(c.Query("token"))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidVerification, "Invalid or expired verification link"))
+		return
+	}
+
+	verified, err := models.MarkEmailVerified(c.Request.Context(), claims.UserID, claims.Email)
+	if err != nil || !verified {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidVerification, "Invalid or expired verification link"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerification sends a new verification email
+// @Summary Resend verification email
+// @Description Send a new verification link. Subject to a cooldown; the response is the same whether or not the address is registered.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body ResendVerificationRequest true "Email address"
+// @Success 202 {object} map[string]interface{} "Verification email sent if the address is registered and unverified"
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Router /verify-email/resend [post]
+func ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	// Work in the background so the response does not reveal whether the address exists
+	email := req.Email
+	utils.RunInBackground(c.Request.Context(), func(ctx context.Context) {
+		user, err := models.GetUserByEmail(ctx, email)
+		if err != nil || user.EmailVerified {
+			return
+		}
+		sendVerificationEmail(ctx, user)
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the address is registered and not yet verified, a verification email has been sent",
+	})
+}
+
+// sendVerificationEmail emails a signed verification link to the user, unless
+// one was already sent within the cooldown period
+func sendVerificationEmail(ctx context.Context, user *models.User) {
+	if user.Email == "" {
+		return
+	}
+
+	cooldown := utils.GetEnvDuration("EMAIL_VERIFICATION_COOLDOWN", 2*time.Minute)
+	reserved, err := models.ReserveVerificationEmail(ctx, user.ID, cooldown)
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to record verification email", "error", err)
+		return
+	}
+	if !reserved {
+		return
+	}
+
+	ttl := utils.GetEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+	token, err := utils.GenerateEmailVerificationToken(user.ID, user.Email, ttl)
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to generate verification token", "error", err)
+		return
+	}
+
+	link := utils.GetEnv("APP_BASE_URL", "http://localhost:8080") + "/verify-email?token=" + url.QueryEscape(token)
+	msg := utils.MailMessage{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please confirm your email address by opening this link within %s:\n\n%s\n\n"+
+			"If you did not create an account, you can ignore this email.\n",
+			user.FullName, ttl, link),
+	}
+
+	err = utils.GetMailer().Send(msg)
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to send verification email", "error", err)
+	}
+}
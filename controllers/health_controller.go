@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ComponentStatus is the result of one readiness check
+type ComponentStatus struct {
+	Status     string  `json:"status" example:"up"` // "up" or "down"
+	Required   bool    `json:"required" example:"true"`
+	DurationMs float64 `json:"duration_ms" example:"1.8"`
+	Details    string  `json:"details,omitempty" example:"applied 18 of 18"` // never the error text, which is only logged
+}
+
+// ReadinessResponse is the readiness probe result
+type ReadinessResponse struct {
+	Status     string                     `json:"status" example:"ready"` // "ready", "not_ready" or "shutting_down"
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// readiness caches the last readiness result so probes and anonymous callers
+// cannot make every request ping the database and bind to the directory
+var readiness struct {
+	mu       sync.Mutex
+	checked  time.Time
+	status   int
+	response ReadinessResponse
+}
+
+// Healthz reports that the process is running
+// @Summary Liveness probe
+// @Description Returns 200 while the process is up. It does not check dependencies.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Process is up"
+// @Router /healthz [get]
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the API can serve traffic
+// @Summary Readiness probe
+// @Description Checks the database, migration status and, when used by AUTH_CHAIN, the LDAP directory, each within READINESS_TIMEOUT. The result is cached for READINESS_CACHE_TTL and failure causes are only logged. Fails as soon as graceful shutdown begins.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse "Not ready or shutting down"
+// @Router /readyz [get]
+func Readyz(c *gin.Context) {
+	if utils.ShuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, ReadinessResponse{
+			Status:     "shutting_down",
+			Components: map[string]ComponentStatus{},
+		})
+		return
+	}
+
+	// Concurrent callers wait for one check and share its result
+	readiness.mu.Lock()
+	if time.Since(readiness.checked) >= utils.GetEnvDuration("READINESS_CACHE_TTL", time.Second) {
+		// The result is shared, so a caller that disconnects must not cut the check short
+		readiness.status, readiness.response = checkReadiness(context.WithoutCancel(c.Request.Context()))
+		readiness.checked = time.Now()
+	}
+	status, response := readiness.status, readiness.response
+	readiness.mu.Unlock()
+
+	c.JSON(status, response)
+}
+
+// checkReadiness checks every dependency and returns the probe status and body
+func checkReadiness(ctx context.Context) (int, ReadinessResponse) {
+	ctx, cancel := context.WithTimeout(ctx, utils.GetEnvDuration("READINESS_TIMEOUT", 2*time.Second))
+	defer cancel()
+
+	components := map[string]ComponentStatus{
+		"database": checkComponent(ctx, "database", true, func() (string, error) {
+			return "", models.PingDB(ctx)
+		}),
+		"migrations": checkComponent(ctx, "migrations", true, func() (string, error) {
+			applied, latest, err := models.MigrationStatus(ctx)
+			if err != nil {
+				return "", err
+			}
+			details := fmt.Sprintf("applied %d of %d", applied, latest)
+			if applied < latest {
+				return details, fmt.Errorf("%s, migrations are pending", details)
+			}
+			return details, nil
+		}),
+	}
+
+	// The directory is only required when no other authenticator can log users in
+	chain := strings.Split(utils.GetEnv("AUTH_CHAIN", "local"), ",")
+	if containsName(chain, "ldap") {
+		components["ldap"] = checkComponent(ctx, "ldap", !containsName(chain, "local"), func() (string, error) {
+			cfg := utils.GetLDAPConfig()
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < cfg.Timeout {
+				cfg.Timeout = time.Until(deadline)
+			}
+			return "", utils.LDAPPing(cfg)
+		})
+	}
+
+	response := ReadinessResponse{Status: "ready", Components: components}
+	status := http.StatusOK
+	for _, component := range components {
+		if component.Required && component.Status != "up" {
+			response.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	return status, response
+}
+
+// Version reports build information
+// @Summary Build information
+// @Description Returns the version, commit and build time of the running binary
+// @Tags Health
+// @Produce json
+// @Success 200 {object} utils.BuildInfo
+// @Router /version [get]
+func Version(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.GetBuildInfo())
+}
+
+// checkComponent runs a readiness check and times it. The error is logged
+// rather than returned, since it may name hosts or carry driver messages.
+func checkComponent(ctx context.Context, name string, required bool, check func() (string, error)) ComponentStatus {
+	start := time.Now()
+	details, err := check()
+
+	status := ComponentStatus{
+		Status:     "up",
+		Required:   required,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Details:    details,
+	}
+	if err != nil {
+		status.Status = "down"
+		utils.Logger(ctx).Warn("Readiness check failed", "component", name, "required", required, "error", err)
+	}
+	return status
+}
+
+// containsName reports whether a comma-separated setting lists name
+func containsName(list []string, name string) bool {
+	for _, item := range list {
+		if strings.TrimSpace(item) == name {
+			return true
+		}
+	}
+	return false
+}
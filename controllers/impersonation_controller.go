@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonateRequest represents the optional request body for starting an impersonation
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"max=500" example:"Ticket #1234: user cannot see their orders"`
+}
+
+// ImpersonateUser issues a short-lived token that acts as another user
+// @Summary Impersonate user
+// @Description Issue a short-lived token for a user so support staff can see what they see (admin only). The token carries the admin in an act claim, every change made with it is audited, and password, email, MFA and account deletion are blocked. Revoke the returned session to end the impersonation early.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param impersonation body ImpersonateRequest false "Reason recorded in the audit log"
+// @Success 200 {object} map[string]interface{} "Impersonation started"
+// @Failure 400 {object} utils.Problem "Invalid user ID or request format"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "User not found"
+// @Failure 500 {object} utils.Problem "Failed to start impersonation"
+// @Router /admin/impersonate/{id} [post]
+func ImpersonateUser(c *gin.Context) {
+	// Only an admin's own login may impersonate, not an OAuth client acting for them
+	if c.GetString("auth_method") != "jwt" {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeImpersonationNotAllowed, "Impersonation requires an admin login"))
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+
+	// The reason is optional, so an empty body is accepted
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	actorID := c.GetInt("user_id")
+	actorName := c.GetString("username")
+	if id == actorID {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeImpersonationNotAllowed, "You cannot impersonate yourself"))
+		return
+	}
+
+	user, err := models.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve user", utils.NewAPIError(http.StatusNotFound, utils.CodeUserNotFound, "User not found")))
+		return
+	}
+
+	// Acting as another admin would hide who really made a change
+	if user.Role == models.RoleAdmin {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeImpersonationNotAllowed, "Administrators cannot be impersonated"))
+		return
+	}
+
+	// The session shows up in the user's device list and can be revoked like any other
+	ttl := utils.GetEnvDuration("IMPERSONATION_TTL", 15*time.Minute)
+	session, err := startSession(c, user.ID, "Impersonated by "+actorName, ttl)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to start impersonation", nil))
+		return
+	}
+
+	actor := utils.Actor{
+		UserID:    actorID,
+		Username:  actorName,
+		SessionID: c.GetString("session_id"),
+	}
+	token, err := utils.GenerateImpersonationToken(user.ID, user.Username, user.Role, session.ID, actor, ttl)
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to generate token", nil))
+		return
+	}
+
+	details := fmt.Sprintf("session: %s ttl: %s", session.ID, ttl)
+	if req.Reason != "" {
+		details += " reason: " + req.Reason
+	}
+	entry := models.AuditLog{
+		Event:   models.AuditImpersonationStart,
+		ActorID: actorID,
+		Actor:   actorName,
+		Target:  fmt.Sprintf("user:%d", user.ID),
+		IP:      c.ClientIP(),
+		Details: details,
+	}
+	if err := entry.Create(c.Request.Context()); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+	}
+	utils.Logger(c.Request.Context()).Info("Impersonation started",
+		"actor_id", actorID, "actor", actorName, "user_id", user.ID, "username", user.Username, "session_id", session.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Impersonation started",
+		"token":        token,
+		"session_id":   session.ID,
+		"expires_at":   session.ExpiresAt,
+		"user":         user,
+		"impersonator": actorName,
+	})
+}
+
+// isImpersonating reports whether the request is made by an admin acting as the user
+func isImpersonating(c *gin.Context) bool {
+	return c.GetInt("actor_id") != 0
+}
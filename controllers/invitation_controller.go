@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Registration modes for POST /users, set with REGISTRATION_MODE
+const (
+	RegistrationOpen   = "open"   // anyone may register
+	RegistrationInvite = "invite" // an invitation code is required
+	RegistrationClosed = "closed" // nobody may register
+)
+
+// invitationCodePrefix marks strings issued by this service as invitation codes
+const invitationCodePrefix = "inv_"
+
+// CreateInvitationRequest represents the request body for creating an invitation
+type CreateInvitationRequest struct {
+	Role      string     `json:"role" example:"user"` // defaults to user
+	MaxUses   int        `json:"max_uses" binding:"omitempty,min=1,max=10000" example:"1"`
+	Note      string     `json:"note" binding:"max=200" example:"New support staff"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2030-01-01T00:00:00Z"`
+}
+
+// CreateInvitationResponse represents a newly created invitation
+type CreateInvitationResponse struct {
+	Code       string            `json:"code" example:"inv_4fQzR8kLm2Xc9VbN"`
+	Invitation models.Invitation `json:"invitation"`
+	Message    string            `json:"message" example:"Share this code now, it will not be shown again"`
+}
+
+// InvitationResponse is an invitation with the accounts created through it
+type InvitationResponse struct {
+	models.Invitation
+	Active      bool                          `json:"active" example:"true"`
+	Redemptions []models.InvitationRedemption `json:"redemptions"`
+}
+
+// registrationMode returns the configured registration mode. Unknown values
+// close registration rather than silently leaving it open.
+func registrationMode(ctx context.Context) string {
+	mode := strings.ToLower(utils.GetEnv("REGISTRATION_MODE", RegistrationOpen))
+	switch mode {
+	case RegistrationOpen, RegistrationInvite, RegistrationClosed:
+		return mode
+	}
+
+	utils.Logger(ctx).Warn("Unknown REGISTRATION_MODE, registration is closed", "mode", mode)
+	return RegistrationClosed
+}
+
+// CreateInvitation creates an invitation code
+// @Summary Create invitation
+// @Description Create an invitation code for registration with an optional preset role, use limit and expiry (admin only). The code is returned only once.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param invitation body CreateInvitationRequest true "Invitation settings"
+// @Success 201 {object} CreateInvitationResponse
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to create invitation"
+// @Router /admin/invitations [post]
+func CreateInvitation(c *gin.Context) {
+	var req CreateInvitationRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	if !models.IsValidRole(req.Role) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidRole, "Invalid role"))
+		return
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidExpiry, "expires_at must be in the future"))
+		return
+	}
+
+	// Generate code; only its hash is stored
+	secret, err := utils.GenerateRandomToken(15)
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to generate invitation code", nil))
+		return
+	}
+	code := invitationCodePrefix + secret
+
+	invitation := models.Invitation{
+		Prefix:    code[:len(invitationCodePrefix)+4],
+		CodeHash:  utils.HashToken(code),
+		Role:      req.Role,
+		Note:      req.Note,
+		MaxUses:   req.MaxUses,
+		CreatedBy: c.GetInt("user_id"),
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	err = invitation.Create(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to create invitation", nil))
+		return
+	}
+
+	auditInvitation(c, models.AuditInvitationCreate, invitation.ID,
+		fmt.Sprintf("role: %s max_uses: %d", invitation.Role, invitation.MaxUses))
+
+	c.JSON(http.StatusCreated, CreateInvitationResponse{
+		Code:       code,
+		Invitation: invitation,
+		Message:    "Share this code now, it will not be shown again",
+	})
+}
+
+// GetInvitations lists all invitations
+// @Summary List invitations
+// @Description List all invitations with their usage, status and the accounts created with them (admin only)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of invitations"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to retrieve invitations"
+// @Router /admin/invitations [get]
+func GetInvitations(c *gin.Context) {
+	invitations, err := models.GetAllInvitations(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve invitations", nil))
+		return
+	}
+
+	response := make([]InvitationResponse, len(invitations))
+	for i, invitation := range invitations {
+		response[i] = InvitationResponse{Invitation: invitation, Active: invitation.IsActive()}
+		if invitation.UseCount == 0 {
+			response[i].Redemptions = []models.InvitationRedemption{}
+			continue
+		}
+		response[i].Redemptions, err = models.GetInvitationRedemptions(c.Request.Context(), invitation.ID)
+		if err != nil {
+			utils.AbortWithError(c, modelError(err, "Failed to retrieve invitations", nil))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitations":       response,
+		"count":             len(response),
+		"registration_mode": registrationMode(c.Request.Context()),
+	})
+}
+
+// RevokeInvitation revokes an invitation
+// @Summary Revoke invitation
+// @Description Revoke an invitation so its code can no longer be used (admin only). Accounts already created with it are not affected.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} map[string]interface{} "Invitation revoked successfully"
+// @Failure 400 {object} utils.Problem "Invalid invitation ID"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "Invitation not found"
+// @Router /admin/invitations/{id} [delete]
+func RevokeInvitation(c *gin.Context) {
+	// Get invitation ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid invitation ID"))
+		return
+	}
+
+	err = models.RevokeInvitation(c.Request.Context(), id)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to revoke invitation", utils.NewAPIError(http.StatusNotFound, utils.CodeInvitationNotFound, "Invitation not found")))
+		return
+	}
+
+	auditInvitation(c, models.AuditInvitationRevoke, id, "")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation revoked successfully",
+	})
+}
+
+// auditInvitation records an admin action on an invitation
+func auditInvitation(c *gin.Context, event string, invitationID int, details string) {
+	entry := models.AuditLog{
+		Event:   event,
+		ActorID: c.GetInt("user_id"),
+		Actor:   c.GetString("username"),
+		Target:  fmt.Sprintf("invitation:%d", invitationID),
+		IP:      c.ClientIP(),
+		Details: details,
+	}
+	if err := entry.Create(c.Request.Context()); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+	}
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UnlockLoginRequest represents the request body for clearing a login lockout
+type UnlockLoginRequest struct {
+	Username string `json:"username" example:"johndoe"`
+	IP       string `json:"ip" example:"192.0.2.10"`
+}
+
+// GetLoginLockouts lists active login lockouts
+// @Summary List login lockouts
+// @Description List usernames and client IPs that are currently locked out (admin only)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of lockouts"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to retrieve lockouts"
+// @Router /admin/lockouts [get]
+func GetLoginLockouts(c *gin.Context) {
+	lockouts, err := models.GetActiveLoginLockouts(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve lockouts", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": lockouts,
+		"count":    len(lockouts),
+	})
+}
+
+// UnlockLogin clears a login lockout
+// @Summary Unlock login
+// @Description Clear failed login counters and lockouts for a username and/or client IP (admin only)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param unlock body UnlockLoginRequest true "Username and/or IP to unlock"
+// @Success 200 {object} map[string]interface{} "Login unlocked successfully"
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to unlock login"
+// @Router /admin/lockouts/unlock [post]
+func UnlockLogin(c *gin.Context) {
+	var req UnlockLoginRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+	if req.Username == "" && req.IP == "" {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeValidationFailed, "username or ip is required"))
+		return
+	}
+
+	var keys []string
+	if req.Username != "" {
+		keys = append(keys, loginUserKey(req.Username))
+	}
+	if req.IP != "" {
+		keys = append(keys, loginIPKey(req.IP))
+	}
+
+	cleared := []string{}
+	for _, key := range keys {
+		ok, err := models.ClearLoginFailures(c.Request.Context(), key)
+		if err != nil {
+			utils.AbortWithError(c, modelError(err, "Failed to unlock login", nil))
+			return
+		}
+		if !ok {
+			continue
+		}
+		cleared = append(cleared, key)
+
+		entry := models.AuditLog{
+			Event:   models.AuditLoginUnlock,
+			ActorID: c.GetInt("user_id"),
+			Actor:   c.GetString("username"),
+			Target:  key,
+			IP:      c.ClientIP(),
+		}
+		if err := entry.Create(c.Request.Context()); err != nil {
+			utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Login unlocked successfully",
+		"cleared": cleared,
+	})
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginThrottleConfig holds brute-force protection settings for login
+type loginThrottleConfig struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+	DelayBase       time.Duration
+	DelayMax        time.Duration
+}
+
+// getLoginThrottleConfig reads brute-force protection settings from environment variables
+func getLoginThrottleConfig() loginThrottleConfig {
+	return loginThrottleConfig{
+		MaxUserFailures: utils.GetEnvInt("LOGIN_MAX_FAILURES", 5),
+		MaxIPFailures:   utils.GetEnvInt("LOGIN_IP_MAX_FAILURES", 20),
+		FailureWindow:   utils.GetEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LockoutDuration: utils.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		DelayBase:       utils.GetEnvDuration("LOGIN_DELAY_BASE", 250*time.Millisecond),
+		DelayMax:        utils.GetEnvDuration("LOGIN_DELAY_MAX", 4*time.Second),
+	}
+}
+
+// loginUserKey returns the throttle key for a username
+func loginUserKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// loginIPKey returns the throttle key for a client IP
+func loginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginAllowed rejects the request with 429 when the username or client IP
+// is locked out. The response is identical for known and unknown usernames.
+func checkLoginAllowed(c *gin.Context, username string) bool {
+	remaining, err := models.LoginLockRemaining(c.Request.Context(), loginUserKey(username), loginIPKey(c.ClientIP()))
+	if err != nil {
+		// Fail open so a throttle table problem does not block every login
+		utils.Logger(c.Request.Context()).Error("Failed to check login lockout", "error", err)
+		return true
+	}
+
+	if remaining > 0 {
+		utils.LoginAttempts.WithLabelValues("locked").Inc()
+		c.Header("Retry-After", fmt.Sprint(int(remaining.Seconds())))
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusTooManyRequests, utils.CodeLoginLocked, "Too many failed login attempts, try again later"))
+		return false
+	}
+
+	return true
+}
+
+// recordLoginFailure counts a failed attempt against the username and client IP,
+// audits new lockouts and applies a progressive delay before responding
+func recordLoginFailure(c *gin.Context, username string) {
+	utils.LoginAttempts.WithLabelValues("failure").Inc()
+
+	cfg := getLoginThrottleConfig()
+	ip := c.ClientIP()
+
+	userFailures, userLocked, err := models.RecordLoginFailure(c.Request.Context(), loginUserKey(username), cfg.MaxUserFailures, cfg.FailureWindow, cfg.LockoutDuration)
+	if err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to record login failure", "error", err)
+	}
+	ipFailures, ipLocked, err := models.RecordLoginFailure(c.Request.Context(), loginIPKey(ip), cfg.MaxIPFailures, cfg.FailureWindow, cfg.LockoutDuration)
+	if err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to record login failure", "error", err)
+	}
+
+	if userLocked {
+		auditLockout(c.Request.Context(), loginUserKey(username), ip, cfg.LockoutDuration)
+	}
+	if ipLocked {
+		auditLockout(c.Request.Context(), loginIPKey(ip), ip, cfg.LockoutDuration)
+	}
+
+	// Progressive delay: base, 2x base, 4x base, ... capped at DelayMax
+	failures := userFailures
+	if ipFailures > failures {
+		failures = ipFailures
+	}
+	if failures > 0 && cfg.DelayBase > 0 {
+		delay := cfg.DelayBase
+		for i := 1; i < failures && delay < cfg.DelayMax; i++ {
+			delay *= 2
+		}
+		if delay > cfg.DelayMax {
+			delay = cfg.DelayMax
+		}
+		time.Sleep(delay)
+	}
+}
+
+// clearLoginFailures resets the failure counter for a username after a successful login.
+// Client IP counters are left to expire so valid logins cannot mask password spraying.
+func clearLoginFailures(ctx context.Context, username string) {
+	_, err := models.ClearLoginFailures(ctx, loginUserKey(username))
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to clear login failures", "error", err)
+	}
+}
+
+// auditLockout records a lockout event
+func auditLockout(ctx context.Context, key string, ip string, duration time.Duration) {
+	utils.Logger(ctx).Warn("Login locked out", "key", key, "ip", ip, "duration", duration.String())
+
+	entry := models.AuditLog{
+		Event:   models.AuditLoginLockout,
+		Target:  key,
+		IP:      ip,
+		Details: fmt.Sprintf("locked for %s", duration),
+	}
+	if err := entry.Create(ctx); err != nil {
+		utils.Logger(ctx).Error("Failed to write audit log", "error", err)
+	}
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFACodeRequest represents a request carrying a TOTP code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// MFAEnrollResponse represents the data needed to add the secret to an authenticator app
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/Simple%20RESTful%20API:johndoe?secret=..."`
+	QRCode     string `json:"qr_code" example:"data:image/png;base64,iVBORw0KGgo..."`
+	Message    string `json:"message" example:"Scan the QR code and confirm with a code from your authenticator app"`
+}
+
+// EnrollMFA starts TOTP enrollment for the current user
+// @Summary Start MFA enrollment
+// @Description Generate a new TOTP secret and return it as an otpauth URI and QR code PNG. MFA stays off until confirmed.
+// @Tags MFA
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MFAEnrollResponse
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Not allowed while impersonating"
+// @Failure 409 {object} utils.Problem "MFA is already enabled"
+// @Failure 500 {object} utils.Problem "Failed to start MFA enrollment"
+// @Router /me/mfa/enroll [post]
+func EnrollMFA(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	state, err := models.GetMFAState(c.Request.Context(), userID)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to start MFA enrollment", nil))
+		return
+	}
+	if state.Enabled {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusConflict, utils.CodeMFAAlreadyEnabled, "MFA is already enabled"))
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to start MFA enrollment", nil))
+		return
+	}
+
+	uri := utils.TOTPURI(utils.GetEnv("MFA_ISSUER", "Simple RESTful API"), c.GetString("username"), secret)
+	png, err := utils.TOTPQRCode(uri)
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to start MFA enrollment", nil))
+		return
+	}
+
+	err = models.SetPendingMFASecret(c.Request.Context(), userID, secret)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to start MFA enrollment", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		Message:    "Scan the QR code and confirm with a code from your authenticator app",
+	})
+}
+
+// ConfirmMFA completes TOTP enrollment for the current user
+// @Summary Confirm MFA enrollment
+// @Description Turn on MFA by proving the authenticator app produces valid codes
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code body MFACodeRequest true "TOTP code"
+// @Success 200 {object} map[string]interface{} "MFA enabled successfully"
+// @Failure 400 {object} utils.Problem "Invalid request or no pending enrollment"
+// @Failure 401 {object} utils.Problem "Unauthorized or invalid code"
+// @Failure 403 {object} utils.Problem "Not allowed while impersonating"
+// @Failure 500 {object} utils.Problem "Failed to enable MFA"
+// @Router /me/mfa/confirm [post]
+func ConfirmMFA(c *gin.Context) {
+	var req MFACodeRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	state, err := models.GetMFAState(c.Request.Context(), userID)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to enable MFA", nil))
+		return
+	}
+	if state.Secret == "" || state.Enabled {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeMFANotPending, "No pending MFA enrollment"))
+		return
+	}
+
+	if !verifyMFACode(c, userID, state.Secret, req.Code) {
+		return
+	}
+
+	err = models.EnableMFA(c.Request.Context(), userID)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to enable MFA", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "MFA enabled successfully",
+	})
+}
+
+// DisableMFA turns off TOTP for the current user
+// @Summary Disable MFA
+// @Description Turn off MFA after confirming a current TOTP code
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code body MFACodeRequest true "TOTP code"
+// @Success 200 {object} map[string]interface{} "MFA disabled successfully"
+// @Failure 400 {object} utils.Problem "Invalid request or MFA not enabled"
+// @Failure 401 {object} utils.Problem "Unauthorized or invalid code"
+// @Failure 403 {object} utils.Problem "Not allowed while impersonating"
+// @Failure 500 {object} utils.Problem "Failed to disable MFA"
+// @Router /me/mfa [delete]
+func DisableMFA(c *gin.Context) {
+	var req MFACodeRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	state, err := models.GetMFAState(c.Request.Context(), userID)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to disable MFA", nil))
+		return
+	}
+	if !state.Enabled {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeMFANotEnabled, "MFA is not enabled"))
+		return
+	}
+
+	if !verifyMFACode(c, userID, state.Secret, req.Code) {
+		return
+	}
+
+	err = models.DisableMFA(c.Request.Context(), userID)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to disable MFA", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "MFA disabled successfully",
+	})
+}
+
+// verifyMFACode validates a TOTP code and marks it as used. On failure it writes
+// the error response and returns false.
+func verifyMFACode(c *gin.Context, userID int, secret string, code string) bool {
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidMFACode, "Invalid MFA code"))
+		return false
+	}
+
+	// Each code may only be used once
+	fresh, err := models.ConsumeMFAStep(c.Request.Context(), userID, step)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to verify MFA code", nil))
+		return false
+	}
+	if !fresh {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeMFACodeReused, "MFA code has already been used"))
+		return false
+	}
+
+	return true
+}
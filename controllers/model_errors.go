@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+)
+
+// modelError converts an error returned by the models into the problem sent to
+// the client: ErrNotFound becomes notFound (or a generic 404 when nil),
+// ErrConflict 409, ErrValidation 422 and ErrUnavailable 503. Any other error is
+// an internal error described by failure.
+func modelError(err error, failure string, notFound *utils.APIError) *utils.APIError {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		if notFound == nil {
+			notFound = utils.NewAPIError(http.StatusNotFound, utils.CodeNotFound, "Record not found")
+		}
+		return notFound.WithCause(err)
+	case errors.Is(err, models.ErrUsernameTaken):
+		return utils.NewAPIError(http.StatusConflict, utils.CodeUsernameTaken, "Username is already taken").WithCause(err)
+	case errors.Is(err, models.ErrEmailTaken):
+		return utils.NewAPIError(http.StatusConflict, utils.CodeEmailTaken, "Email address is already in use").WithCause(err)
+	case errors.Is(err, models.ErrConflict):
+		return utils.NewAPIError(http.StatusConflict, utils.CodeConflict, failure+": conflicts with an existing record").WithCause(err)
+	case errors.Is(err, models.ErrValidation):
+		return utils.NewAPIError(http.StatusUnprocessableEntity, utils.CodeValidationFailed, failure+": a value is invalid or too long").WithCause(err)
+	case errors.Is(err, models.ErrUnavailable):
+		return utils.NewAPIError(http.StatusServiceUnavailable, utils.CodeServiceUnavailable, "The database is unavailable, try again later").WithCause(err)
+	default:
+		return utils.InternalError(failure, err)
+	}
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateOAuthClientRequest represents the request body for registering an OAuth client
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required" example:"Intranet portal"`
+	RedirectURIs []string `json:"redirect_uris" example:"https://intranet.example.com/callback"`
+	GrantTypes   []string `json:"grant_types" binding:"required,min=1" example:"authorization_code"`
+	Scopes       []string `json:"scopes" binding:"required,min=1" example:"users:read"`
+	Confidential bool     `json:"confidential" example:"true"` // issue a client secret; required for client_credentials
+}
+
+// CreateOAuthClientResponse represents a newly registered OAuth client
+type CreateOAuthClientResponse struct {
+	ClientSecret string             `json:"client_secret,omitempty" example:"k9Vt2..."`
+	Client       models.OAuthClient `json:"client"`
+	Message      string             `json:"message" example:"Store the client secret now, it will not be shown again"`
+}
+
+// CreateOAuthClient registers a new OAuth client
+// @Summary Register OAuth client
+// @Description Register an application that obtains tokens through OAuth 2.0 (admin only). The client secret of confidential clients is returned only once.
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param client body CreateOAuthClientRequest true "OAuth client data"
+// @Success 201 {object} CreateOAuthClientResponse
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to register OAuth client"
+// @Router /admin/oauth/clients [post]
+func CreateOAuthClient(c *gin.Context) {
+	var req CreateOAuthClientRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	// Validate grant types, scopes and redirect URIs
+	for _, grant := range req.GrantTypes {
+		if !models.IsValidGrantType(grant) {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidGrantType, "Invalid grant type: "+grant))
+			return
+		}
+		if grant == models.GrantClientCredentials && !req.Confidential {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidClientConfig, "client_credentials requires a confidential client"))
+			return
+		}
+		if grant == models.GrantAuthorizationCode && len(req.RedirectURIs) == 0 {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidClientConfig, "authorization_code requires at least one redirect URI"))
+			return
+		}
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidScope, "Invalid scope: "+scope))
+			return
+		}
+	}
+	for _, uri := range req.RedirectURIs {
+		if !isValidRedirectURI(uri) {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidRedirectURI, "Invalid redirect URI (https is required, http only for loopback addresses): "+uri))
+			return
+		}
+	}
+
+	clientID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to generate client credentials", nil))
+		return
+	}
+
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		CreatedBy:    c.GetInt("user_id"),
+	}
+
+	// Only the hash of the secret is stored
+	var secret string
+	if req.Confidential {
+		secret, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			utils.AbortWithError(c, utils.InternalError("Failed to generate client credentials", nil))
+			return
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	err = client.Create(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to register OAuth client", nil))
+		return
+	}
+
+	response := CreateOAuthClientResponse{
+		ClientSecret: secret,
+		Client:       client,
+		Message:      "OAuth client registered successfully",
+	}
+	if secret != "" {
+		response.Message = "Store the client secret now, it will not be shown again"
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetOAuthClients lists all OAuth clients
+// @Summary List OAuth clients
+// @Description List all registered OAuth clients (admin only)
+// @Tags OAuth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of OAuth clients"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to retrieve OAuth clients"
+// @Router /admin/oauth/clients [get]
+func GetOAuthClients(c *gin.Context) {
+	clients, err := models.GetAllOAuthClients(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve OAuth clients", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clients": clients,
+		"count":   len(clients),
+	})
+}
+
+// RevokeOAuthClient revokes an OAuth client
+// @Summary Revoke OAuth client
+// @Description Revoke an OAuth client so it can no longer obtain tokens and the tokens it issued stop working (admin only)
+// @Tags OAuth
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "OAuth client ID"
+// @Success 200 {object} map[string]interface{} "OAuth client revoked successfully"
+// @Failure 400 {object} utils.Problem "Invalid OAuth client ID"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "OAuth client not found"
+// @Router /admin/oauth/clients/{id} [delete]
+func RevokeOAuthClient(c *gin.Context) {
+	// Get OAuth client ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid OAuth client ID"))
+		return
+	}
+
+	err = models.RevokeOAuthClient(c.Request.Context(), id)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to revoke OAuth client", utils.NewAPIError(http.StatusNotFound, utils.CodeOAuthClientNotFound, "OAuth client not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "OAuth client revoked successfully",
+	})
+}
+
+// isValidRedirectURI reports whether uri is an absolute https URL without a
+// fragment or whitespace (redirect URIs are stored space-separated). Plain http
+// is only allowed for loopback addresses, where the code never leaves the device.
+func isValidRedirectURI(uri string) bool {
+	if strings.ContainsAny(uri, " \t\r\n") {
+		return false
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	return u.Scheme == "https" || (u.Scheme == "http" && isLoopbackHost(u.Hostname()))
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP address
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
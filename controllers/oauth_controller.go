@@ -0,0 +1,538 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthorizeRequest holds the OAuth 2.0 authorization request parameters
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// OAuthTokenResponse represents a successful token response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	TokenType   string `json:"token_type" example:"Bearer"`
+	ExpiresIn   int    `json:"expires_in" example:"3600"`
+	Scope       string `json:"scope" example:"users:read"`
+}
+
+// scopeDescriptions are shown on the consent page
+var scopeDescriptions = map[string]string{
+	models.ScopeUsersRead:  "Read user accounts",
+	models.ScopeUsersWrite: "Update and delete user accounts",
+	models.ScopeAccount:    "Manage your MFA settings and sessions",
+	models.ScopeAdmin:      "Use admin functions (admin accounts only)",
+}
+
+// authorizePage is the combined login and consent page
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in to {{.ClientName}}</title>
+<style>
+body { font-family: sans-serif; background: #f4f5f7; margin: 0; }
+main { max-width: 360px; margin: 60px auto; background: #fff; padding: 24px; border-radius: 8px; }
+label { display: block; margin-top: 12px; }
+input[type=text], input[type=password] { width: 100%; padding: 8px; box-sizing: border-box; }
+.error { color: #b00020; }
+.actions { margin-top: 20px; display: flex; gap: 8px; }
+</style>
+</head>
+<body>
+<main>
+<h1>Sign in</h1>
+<p><strong>{{.ClientName}}</strong> is requesting access to your account:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<label>Username <input type="text" name="username" value="{{.Username}}" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<label>Authenticator code (if MFA is enabled) <input type="text" name="mfa_code" inputmode="numeric" autocomplete="one-time-code"></label>
+<div class="actions">
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</div>
+</form>
+</main>
+</body>
+</html>`))
+
+// authorizePageData is rendered by authorizePage
+type authorizePageData struct {
+	ClientName string
+	Scopes     []string
+	Request    AuthorizeRequest
+	Username   string
+	Error      string
+	CSRFToken  string // set by renderAuthorizePage
+}
+
+// authorizeCSRFCookie holds the nonce that the authorization form's CSRF token is signed for
+const authorizeCSRFCookie = "oauth_csrf"
+
+// OAuthAuthorize shows the login and consent page for an authorization request
+// @Summary OAuth authorization endpoint
+// @Description Start an OAuth 2.0 authorization code flow. PKCE with S256 is required. Renders an HTML login and consent page.
+// @Tags OAuth
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space-separated scopes (defaults to all scopes registered for the client)"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {string} string "Login and consent page"
+// @Failure 302 {string} string "Redirect to the client with an error"
+// @Failure 400 {string} string "Unknown client or redirect URI"
+// @Router /oauth/authorize [get]
+func OAuthAuthorize(c *gin.Context) {
+	var req AuthorizeRequest
+	c.ShouldBindQuery(&req)
+
+	client, scopes, ok := validateAuthorizeRequest(c, req)
+	if !ok {
+		return
+	}
+
+	renderAuthorizePage(c, http.StatusOK, authorizePageData{
+		ClientName: client.Name,
+		Scopes:     describeScopes(scopes),
+		Request:    req,
+	})
+}
+
+// OAuthAuthorizeSubmit handles the login and consent form
+// @Summary OAuth authorization form
+// @Description Submit the login and consent form. On approval the browser is redirected to the client with an authorization code.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param username formData string true "Username"
+// @Param password formData string true "Password"
+// @Param mfa_code formData string false "TOTP code when MFA is enabled"
+// @Param action formData string true "approve or deny"
+// @Param csrf_token formData string true "Form token from the rendered page"
+// @Success 303 {string} string "Redirect to the client with a code or an error"
+// @Failure 400 {string} string "Unknown client or redirect URI"
+// @Failure 401 {string} string "Invalid credentials, page is shown again"
+// @Failure 403 {string} string "Invalid or missing form token"
+// @Failure 429 {string} string "Too many failed login attempts"
+// @Router /oauth/authorize [post]
+func OAuthAuthorizeSubmit(c *gin.Context) {
+	var req AuthorizeRequest
+	c.ShouldBind(&req)
+
+	client, scopes, ok := validateAuthorizeRequest(c, req)
+	if !ok {
+		return
+	}
+
+	// The form must come from a page this server rendered for the same browser
+	nonce, _ := c.Cookie(authorizeCSRFCookie)
+	if !utils.ValidCSRFToken(nonce, c.PostForm("csrf_token")) {
+		c.String(http.StatusForbidden, "Invalid or missing form token, reload the page and try again")
+		return
+	}
+
+	if c.PostForm("action") != "approve" {
+		redirectWithParams(c, req.RedirectURI, url.Values{
+			"error": {"access_denied"},
+			"state": {req.State},
+		})
+		return
+	}
+
+	username := c.PostForm("username")
+	page := authorizePageData{
+		ClientName: client.Name,
+		Scopes:     describeScopes(scopes),
+		Request:    req,
+		Username:   username,
+	}
+
+	user, status, message := authenticateForm(c, username, c.PostForm("password"), c.PostForm("mfa_code"))
+	if user == nil {
+		page.Error = message
+		renderAuthorizePage(c, status, page)
+		return
+	}
+
+	code, err := utils.GenerateRandomToken(32)
+	if err == nil {
+		err = models.CreateOAuthCode(c.Request.Context(), &models.OAuthCode{
+			CodeHash:      utils.HashToken(code),
+			ClientID:      client.ClientID,
+			UserID:        user.ID,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        scopes,
+			CodeChallenge: req.CodeChallenge,
+		}, utils.GetEnvDuration("OAUTH_CODE_TTL", 2*time.Minute))
+	}
+	if err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to create authorization code", "error", err)
+		redirectWithParams(c, req.RedirectURI, url.Values{
+			"error": {"server_error"},
+			"state": {req.State},
+		})
+		return
+	}
+
+	entry := models.AuditLog{
+		Event:   models.AuditOAuthConsent,
+		ActorID: user.ID,
+		Actor:   user.Username,
+		Target:  "oauth_client:" + client.ClientID,
+		IP:      c.ClientIP(),
+		Details: "scopes: " + strings.Join(scopes, " "),
+	}
+	if err := entry.Create(c.Request.Context()); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+	}
+
+	redirectWithParams(c, req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	})
+}
+
+// OAuthToken issues access tokens
+// @Summary OAuth token endpoint
+// @Description Exchange an authorization code (with PKCE verifier) or client credentials for an access token. Clients authenticate with HTTP Basic or client_id/client_secret form fields.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code or client_credentials"
+// @Param code formData string false "Authorization code (authorization_code)"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request (authorization_code)"
+// @Param code_verifier formData string false "PKCE code verifier (authorization_code)"
+// @Param scope formData string false "Space-separated scopes (client_credentials)"
+// @Param client_id formData string false "Client ID, when not using HTTP Basic"
+// @Param client_secret formData string false "Client secret, when not using HTTP Basic"
+// @Success 200 {object} OAuthTokenResponse
+// @Failure 400 {object} map[string]interface{} "invalid_request, invalid_grant, invalid_scope or unsupported_grant_type"
+// @Failure 401 {object} map[string]interface{} "invalid_client"
+// @Router /oauth/token [post]
+func OAuthToken(c *gin.Context) {
+	// Token responses must never be cached
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, ok := authenticateOAuthClient(c)
+	if !ok {
+		return
+	}
+
+	grantType := c.PostForm("grant_type")
+	if !models.IsValidGrantType(grantType) {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or client_credentials")
+		return
+	}
+	if !client.AllowsGrant(grantType) {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", "client is not registered for this grant type")
+		return
+	}
+
+	ttl := utils.GetEnvDuration("OAUTH_ACCESS_TOKEN_TTL", time.Hour)
+
+	if grantType == models.GrantClientCredentials {
+		scopes := strings.Fields(c.PostForm("scope"))
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+		if !client.AllowsScopes(scopes) {
+			oauthError(c, http.StatusBadRequest, "invalid_scope", "requested scope is not registered for this client")
+			return
+		}
+
+		// The client acts as a service principal, like an API key
+		token, err := utils.GenerateOAuthToken(0, "oauth:"+client.Name, models.RoleService, "", client.ClientID, scopes, ttl)
+		if err != nil {
+			oauthError(c, http.StatusInternalServerError, "server_error", "failed to generate token")
+			return
+		}
+
+		c.JSON(http.StatusOK, OAuthTokenResponse{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(ttl.Seconds()),
+			Scope:       strings.Join(scopes, " "),
+		})
+		return
+	}
+
+	// Authorization codes are single-use, so a failed exchange cannot be retried
+	code, err := models.ConsumeOAuthCode(c.Request.Context(), utils.HashToken(c.PostForm("code")))
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "authorization code is invalid, expired or already used")
+		return
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != c.PostForm("redirect_uri") {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client or redirect URI")
+		return
+	}
+	if !utils.VerifyPKCE(c.PostForm("code_verifier"), code.CodeChallenge) {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+		return
+	}
+
+	user, err := models.GetUserByID(c.Request.Context(), code.UserID)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "user no longer exists")
+		return
+	}
+
+	// Delegated tokens get their own session so the user can revoke the app's access
+	session, err := startSession(c, user.ID, client.Name+" (OAuth)", ttl)
+	if err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to create session", "error", err)
+		oauthError(c, http.StatusInternalServerError, "server_error", "failed to create session")
+		return
+	}
+
+	token, err := utils.GenerateOAuthToken(user.ID, user.Username, user.Role, session.ID, client.ClientID, code.Scopes, ttl)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "failed to generate token")
+		return
+	}
+
+	c.JSON(http.StatusOK, OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       strings.Join(code.Scopes, " "),
+	})
+}
+
+// validateAuthorizeRequest checks an authorization request and returns the client
+// and granted scopes. Problems with the client or redirect URI are shown to the
+// user; anything else is reported back to the client through the redirect URI.
+func validateAuthorizeRequest(c *gin.Context, req AuthorizeRequest) (*models.OAuthClient, []string, bool) {
+	client, err := models.GetOAuthClientByClientID(c.Request.Context(), req.ClientID)
+	if err != nil || !client.IsActive() {
+		c.String(http.StatusBadRequest, "Unknown or revoked OAuth client")
+		return nil, nil, false
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		c.String(http.StatusBadRequest, "Redirect URI is not registered for this client")
+		return nil, nil, false
+	}
+	// Clients registered before plain http was limited to loopback may still list such URIs
+	if !isValidRedirectURI(req.RedirectURI) {
+		c.String(http.StatusBadRequest, "Redirect URI must use https unless it points at a loopback address")
+		return nil, nil, false
+	}
+
+	fail := func(code string, description string) (*models.OAuthClient, []string, bool) {
+		redirectWithParams(c, req.RedirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {req.State},
+		})
+		return nil, nil, false
+	}
+
+	if req.ResponseType != "code" {
+		return fail("unsupported_response_type", "response_type must be code")
+	}
+	if !client.AllowsGrant(models.GrantAuthorizationCode) {
+		return fail("unauthorized_client", "client is not registered for the authorization code grant")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return fail("invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.AllowsScopes(scopes) {
+		return fail("invalid_scope", "requested scope is not registered for this client")
+	}
+
+	return client, scopes, true
+}
+
+// authenticateForm checks the credentials submitted on the authorization page,
+// applying the same lockout, MFA and email verification rules as /login.
+// On failure it returns a nil user with the status and message to show.
+func authenticateForm(c *gin.Context, username string, password string, mfaCode string) (*models.User, int, string) {
+	remaining, err := models.LoginLockRemaining(c.Request.Context(), loginUserKey(username), loginIPKey(c.ClientIP()))
+	if err != nil {
+		// Fail open so a throttle table problem does not block every login
+		utils.Logger(c.Request.Context()).Error("Failed to check login lockout", "error", err)
+	}
+	if remaining > 0 {
+		return nil, http.StatusTooManyRequests, "Too many failed login attempts, try again later"
+	}
+
+	user, err := authenticatePassword(c.Request.Context(), username, password)
+	if err == errAuthUnavailable {
+		return nil, http.StatusServiceUnavailable, "Authentication service unavailable, try again later"
+	}
+	if err != nil {
+		recordLoginFailure(c, username)
+		return nil, http.StatusUnauthorized, "Invalid username or password"
+	}
+
+	if blockedByEmailVerification(user) {
+		return nil, http.StatusForbidden, "Email address not verified"
+	}
+
+	if user.MFAEnabled {
+		if mfaCode == "" {
+			return nil, http.StatusUnauthorized, "Enter the code from your authenticator app"
+		}
+
+		state, err := models.GetMFAState(c.Request.Context(), user.ID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Failed to verify MFA code"
+		}
+		step, valid := utils.ValidateTOTP(state.Secret, mfaCode, time.Now())
+		if !valid {
+			recordLoginFailure(c, username)
+			return nil, http.StatusUnauthorized, "Invalid MFA code"
+		}
+
+		// Each code may only be used once
+		fresh, err := models.ConsumeMFAStep(c.Request.Context(), user.ID, step)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Failed to verify MFA code"
+		}
+		if !fresh {
+			return nil, http.StatusUnauthorized, "MFA code has already been used"
+		}
+	}
+
+	utils.LoginAttempts.WithLabelValues("success").Inc()
+	clearLoginFailures(c.Request.Context(), user.Username)
+	return user, http.StatusOK, ""
+}
+
+// authenticateOAuthClient identifies the client calling the token endpoint from
+// HTTP Basic credentials or the client_id and client_secret form fields
+func authenticateOAuthClient(c *gin.Context) (*models.OAuthClient, bool) {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1: Basic credentials are form-encoded
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+
+	client, err := models.GetOAuthClientByClientID(c.Request.Context(), clientID)
+	if err == nil && client.IsActive() {
+		if client.IsConfidential() {
+			given := utils.HashToken(secret)
+			if subtle.ConstantTimeCompare([]byte(given), []byte(client.SecretHash)) == 1 {
+				return client, true
+			}
+		} else if secret == "" {
+			// Public clients have no secret; PKCE protects their codes
+			return client, true
+		}
+	}
+
+	if basic {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	return nil, false
+}
+
+// oauthError sends an error response in the format required by RFC 6749 section 5.2
+func oauthError(c *gin.Context, status int, code string, description string) {
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+		"request_id":        c.GetString("request_id"),
+	})
+}
+
+// redirectWithParams redirects the browser to uri with params added to its query string
+func redirectWithParams(c *gin.Context, uri string, params url.Values) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid redirect URI")
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusSeeOther, u.String())
+}
+
+// renderAuthorizePage writes the login and consent page
+func renderAuthorizePage(c *gin.Context, status int, data authorizePageData) {
+	// Each render gets a new nonce in a cookie and a token signed for it in the form
+	nonce, token, err := utils.NewCSRFToken()
+	if err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to generate CSRF token", "error", err)
+		c.String(http.StatusInternalServerError, "Failed to render authorization page")
+		return
+	}
+	data.CSRFToken = token
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(authorizeCSRFCookie, nonce, int(time.Hour.Seconds()), "/oauth/authorize", "", c.Request.TLS != nil, true)
+
+	// The page collects credentials, so it must not be framed or cached
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+
+	if err := authorizePage.Execute(c.Writer, data); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to render authorization page", "error", err)
+	}
+}
+
+// describeScopes returns the consent page text for each scope
+func describeScopes(scopes []string) []string {
+	descriptions := make([]string, len(scopes))
+	for i, scope := range scopes {
+		description, ok := scopeDescriptions[scope]
+		if !ok {
+			description = scope
+		}
+		descriptions[i] = fmt.Sprintf("%s (%s)", description, scope)
+	}
+	return descriptions
+}
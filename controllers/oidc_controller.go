@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie binds a login started at /login/oidc to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// oidcStateTTL is how long a user has to finish logging in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCLogin starts a login at the external OpenID Connect provider
+// @Summary Login with OpenID Connect
+// @Description Redirect the browser to the configured OpenID Connect provider. After login the provider redirects back to /login/oidc/callback.
+// @Tags Authentication
+// @Param login_hint query string false "Username or email to suggest to the provider"
+// @Success 302 {string} string "Redirect to the provider"
+// @Failure 404 {object} utils.Problem "OIDC login is not configured"
+// @Failure 502 {object} utils.Problem "OIDC provider unavailable"
+// @Router /login/oidc [get]
+func OIDCLogin(c *gin.Context) {
+	provider := utils.GetOIDCProvider()
+	cfg := provider.Config()
+	if !cfg.Enabled() {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusNotFound, utils.CodeOIDCNotConfigured, "OIDC login is not configured"))
+		return
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to start OIDC login", nil))
+		return
+	}
+	nonce, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to start OIDC login", nil))
+		return
+	}
+	verifier, challenge, err := utils.GeneratePKCE()
+	if err != nil {
+		utils.AbortWithError(c, utils.InternalError("Failed to start OIDC login", nil))
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge, c.Query("login_hint"))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadGateway, utils.CodeOIDCUnavailable, "OIDC provider unavailable").WithCause(err))
+		return
+	}
+
+	err = models.CreateOIDCLoginState(c.Request.Context(), utils.HashToken(state), nonce, verifier, oidcStateTTL)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to start OIDC login", nil))
+		return
+	}
+
+	// Lax lets the cookie through on the provider's top-level redirect back to us
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), "/login/oidc",
+		"", strings.HasPrefix(cfg.RedirectURL, "https://"), true)
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes a login at the external OpenID Connect provider
+// @Summary OpenID Connect callback
+// @Description Exchange the provider's authorization code, validate the ID token and log in the linked local user. Unknown users are linked by verified email or username, or provisioned, depending on configuration.
+// @Tags Authentication
+// @Produce json
+// @Param code query string true "Authorization code from the provider"
+// @Param state query string true "State from /login/oidc"
+// @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
+// @Failure 400 {object} utils.Problem "Invalid or expired OIDC login state"
+// @Failure 401 {object} utils.Problem "OIDC login failed"
+// @Failure 403 {object} utils.Problem "No local account is linked to this identity, registration is closed or the email address is not verified"
+// @Failure 409 {object} utils.Problem "Account could not be provisioned"
+// @Failure 503 {object} utils.Problem "Database unavailable"
+// @Failure 502 {object} utils.Problem "OIDC provider unavailable"
+// @Router /login/oidc/callback [get]
+func OIDCCallback(c *gin.Context) {
+	provider := utils.GetOIDCProvider()
+	if !provider.Config().Enabled() {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusNotFound, utils.CodeOIDCNotConfigured, "OIDC login is not configured"))
+		return
+	}
+
+	// The state cookie is single-use
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/login/oidc", "", false, true)
+
+	if errCode := c.Query("error"); errCode != "" {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeOIDCLoginFailed, "OIDC login failed: "+strings.TrimSpace(errCode+" "+c.Query("error_description"))))
+		return
+	}
+
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidOIDCState, "Invalid or expired OIDC login state"))
+		return
+	}
+	nonce, verifier, err := models.ConsumeOIDCLoginState(c.Request.Context(), utils.HashToken(state))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidOIDCState, "Invalid or expired OIDC login state"))
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(c.Request.Context(), c.Query("code"), verifier)
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadGateway, utils.CodeOIDCUnavailable, "OIDC provider unavailable").WithCause(err))
+		return
+	}
+	identity, err := provider.VerifyIDToken(c.Request.Context(), rawIDToken, nonce)
+	if err != nil {
+		utils.Logger(c.Request.Context()).Warn("Rejected OIDC ID token", "error", err)
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeOIDCLoginFailed, "OIDC login failed: ID token could not be verified"))
+		return
+	}
+
+	user, apiErr := resolveOIDCUser(c, identity)
+	if apiErr != nil {
+		utils.AbortWithError(c, apiErr)
+		return
+	}
+
+	// Same rule as password login, for accounts linked or provisioned without a verified address
+	if blockedByEmailVerification(user) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeEmailNotVerified, "Email address not verified"))
+		return
+	}
+
+	// The provider replaces the password, but local MFA still applies
+	if user.MFAEnabled {
+		respondWithMFAChallenge(c, user)
+		return
+	}
+
+	respondWithToken(c, user, "")
+}
+
+// resolveOIDCUser finds the local user for a verified identity: an existing link
+// first, then a match by verified email or username as configured by OIDC_LINK_BY,
+// and finally a newly provisioned user when OIDC_AUTO_PROVISION is enabled and
+// registration is open.
+// On failure it returns the error to send.
+func resolveOIDCUser(c *gin.Context, identity *utils.OIDCIdentity) (*models.User, *utils.APIError) {
+	cfg := utils.GetOIDCProvider().Config()
+
+	existing, err := models.GetUserIdentity(c.Request.Context(), identity.Issuer, identity.Subject)
+	if err == nil {
+		if err := models.TouchUserIdentity(c.Request.Context(), existing.ID); err != nil {
+			utils.Logger(c.Request.Context()).Error("Failed to update identity", "error", err)
+		}
+		user, err := models.GetUserByID(c.Request.Context(), existing.UserID)
+		if err != nil {
+			return nil, modelError(err, "Failed to load linked account",
+				utils.NewAPIError(http.StatusForbidden, utils.CodeOIDCAccountNotLinked, "No local account is linked to this identity"))
+		}
+		return user, nil
+	}
+	// Only a missing link may lead to linking or provisioning; after any other
+	// failure that could create a duplicate account
+	if !errors.Is(err, models.ErrNotFound) {
+		return nil, modelError(err, "Failed to look up identity", nil)
+	}
+
+	// Link to an existing account
+	var user *models.User
+	switch cfg.LinkBy {
+	case "email":
+		if identity.Email != "" && identity.EmailVerified {
+			local, err := models.GetUserByEmail(c.Request.Context(), identity.Email)
+			if err != nil && !errors.Is(err, models.ErrNotFound) {
+				return nil, modelError(err, "Failed to link identity", nil)
+			}
+			if err == nil {
+				// An unverified local address could belong to someone else
+				if !local.EmailVerified {
+					return nil, utils.NewAPIError(http.StatusConflict, utils.CodeOIDCAccountConflict, "An account with this email exists but the address is not verified")
+				}
+				user = local
+			}
+		}
+	case "username":
+		if identity.Username != "" {
+			local, err := models.GetUserByUsername(c.Request.Context(), identity.Username)
+			if err != nil && !errors.Is(err, models.ErrNotFound) {
+				return nil, modelError(err, "Failed to link identity", nil)
+			}
+			if err == nil {
+				// Many providers let users edit their username, so only OIDC accounts
+				// that have lost their identity are matched this way. Linking another
+				// identity to an account would let anyone who takes the name log in to it.
+				if local.AuthSource != models.AuthSourceOIDC {
+					return nil, utils.NewAPIError(http.StatusConflict, utils.CodeOIDCAccountConflict, "An account with this username exists but cannot be linked automatically")
+				}
+				linked, err := models.UserHasIdentity(c.Request.Context(), local.ID)
+				if err != nil {
+					return nil, modelError(err, "Failed to link identity", nil)
+				}
+				if linked {
+					return nil, utils.NewAPIError(http.StatusConflict, utils.CodeOIDCAccountConflict, "An account with this username is already linked to another identity")
+				}
+				user = local
+			}
+		}
+	}
+
+	// A mistaken match would hand over admin rights, so admins are never linked automatically
+	if user != nil && user.Role == models.RoleAdmin {
+		return nil, utils.NewAPIError(http.StatusConflict, utils.CodeOIDCAccountConflict, "Admin accounts cannot be linked automatically")
+	}
+
+	if user != nil {
+		link := models.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Issuer,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}
+		if err := link.Create(c.Request.Context()); err != nil {
+			return nil, modelError(err, "Failed to link identity", nil)
+		}
+		auditOIDC(c, models.AuditOIDCLink, user, identity)
+		return user, nil
+	}
+
+	if !cfg.AutoProvision {
+		return nil, utils.NewAPIError(http.StatusForbidden, utils.CodeOIDCAccountNotLinked, "No local account is linked to this identity")
+	}
+	// Provisioning is a form of registration, so it follows REGISTRATION_MODE unless overridden
+	if registrationMode(c.Request.Context()) != RegistrationOpen && !cfg.ProvisionWhenClosed {
+		return nil, utils.NewAPIError(http.StatusForbidden, utils.CodeRegistrationClosed, "Registration is closed")
+	}
+	return provisionOIDCUser(c, identity)
+}
+
+// provisionOIDCUser creates a local user for an identity that has no account yet
+func provisionOIDCUser(c *gin.Context, identity *utils.OIDCIdentity) (*models.User, *utils.APIError) {
+	username := identity.Username
+	if username == "" && identity.Email != "" {
+		username = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	if username == "" || len([]rune(username)) > 50 {
+		return nil, utils.NewAPIError(http.StatusConflict, utils.CodeOIDCAccountConflict, "The provider did not supply a usable username")
+	}
+	if _, err := models.GetUserByUsername(c.Request.Context(), username); err == nil {
+		return nil, utils.NewAPIError(http.StatusConflict, utils.CodeOIDCAccountConflict, "Username is already taken by a local account")
+	}
+
+	// Only keep the email when the provider vouches for it and it is not in use
+	email := ""
+	if identity.Email != "" && identity.EmailVerified {
+		if _, err := models.GetUserByEmail(c.Request.Context(), identity.Email); err != nil {
+			email = identity.Email
+		}
+	}
+
+	fullName := identity.Name
+	if fullName == "" {
+		fullName = username
+	}
+
+	// Provisioned users sign in through the provider, so the local password is random
+	password, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, utils.InternalError("Failed to provision account", err)
+	}
+	hash, err := utils.HashPassword(c.Request.Context(), password)
+	if err != nil {
+		return nil, utils.InternalError("Failed to provision account", err)
+	}
+
+	user := &models.User{
+		Username: username,
+		FullName: fullName,
+		Email:    email,
+	}
+	link := &models.UserIdentity{
+		Provider: identity.Issuer,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	err = models.CreateUserWithIdentity(c.Request.Context(), user, hash, link, email != "")
+	if err != nil {
+		return nil, utils.NewAPIError(http.StatusConflict, utils.CodeOIDCAccountConflict, "Failed to provision account").WithCause(err)
+	}
+
+	auditOIDC(c, models.AuditOIDCProvision, user, identity)
+	return user, nil
+}
+
+// auditOIDC records an identity being linked or provisioned
+func auditOIDC(c *gin.Context, event string, user *models.User, identity *utils.OIDCIdentity) {
+	entry := models.AuditLog{
+		Event:   event,
+		ActorID: user.ID,
+		Actor:   user.Username,
+		Target:  fmt.Sprintf("user:%d", user.ID),
+		IP:      c.ClientIP(),
+		Details: fmt.Sprintf("provider: %s subject: %s", identity.Issuer, identity.Subject),
+	}
+	if err := entry.Create(c.Request.Context()); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+	}
+}
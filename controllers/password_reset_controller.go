@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// ForgotPasswordRequest represents a request for a password reset email
+type ForgotPasswordRequest struct {
+	Username string `json:"username" example:"johndoe"`
+	Email    string `json:"email" binding:"omitempty,email" example:"john@example.com"`
+}
+
+// ResetPasswordRequest represents the request body for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" form:"token" binding:"required" example:"q8Jx2..."`
+	NewPassword string `json:"new_password" form:"new_password" binding:"required" example:"GreenValley73"`
+}
+
+// resetPasswordPage is the page opened from the reset email when no
+// PASSWORD_RESET_URL front-end is configured
+var resetPasswordPage = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Reset your password</title>
+<style>
+body { font-family: sans-serif; background: #f4f5f7; margin: 0; }
+main { max-width: 360px; margin: 60px auto; background: #fff; padding: 24px; border-radius: 8px; }
+label { display: block; margin-top: 12px; }
+input[type=password] { width: 100%; padding: 8px; box-sizing: border-box; }
+.error { color: #b00020; }
+.actions { margin-top: 20px; }
+</style>
+</head>
+<body>
+<main>
+<h1>Reset your password</h1>
+{{if .Done}}<p>Your password has been reset. You can now sign in with your new password.</p>
+{{else}}{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{range .Violations}}<p class="error">{{.Message}}</p>{{end}}
+<form method="post" action="/password/reset">
+<input type="hidden" name="token" value="{{.Token}}">
+<label>New password <input type="password" name="new_password" autocomplete="new-password" required></label>
+<div class="actions"><button type="submit">Reset password</button></div>
+</form>{{end}}
+</main>
+</body>
+</html>`))
+
+// resetPasswordPageData is rendered by resetPasswordPage
+type resetPasswordPageData struct {
+	Token      string
+	Error      string
+	Violations []utils.PasswordViolation
+	Done       bool
+}
+
+// ForgotPassword starts a self-service password reset
+// @Summary Request password reset
+// @Description Send a single-use password reset token to the user's email address. The response is the same whether or not the account exists.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Username or email"
+// @Success 202 {object} map[string]interface{} "Reset instructions sent if the account exists"
+// @Failure 400 {object} utils.Problem "Invalid request format"
+// @Router /password/forgot [post]
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+	if req.Username == "" && req.Email == "" {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeValidationFailed, "username or email is required"))
+		return
+	}
+
+	// Look up the account and send mail in the background so the response
+	// time does not reveal whether the account exists
+	utils.RunInBackground(c.Request.Context(), func(ctx context.Context) { sendPasswordReset(ctx, req.Username, req.Email) })
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the account exists and has an email address, reset instructions have been sent",
+	})
+}
+
+// ResetPasswordForm shows the page linked from the password reset email
+// @Summary Password reset page
+// @Description Render an HTML form for choosing a new password with a reset token. Used when PASSWORD_RESET_URL is not set.
+// @Tags Authentication
+// @Produce html
+// @Param token query string true "Reset token from the email"
+// @Success 200 {string} string "Password reset page"
+// @Router /password/reset [get]
+func ResetPasswordForm(c *gin.Context) {
+	renderResetPasswordPage(c, http.StatusOK, resetPasswordPageData{Token: c.Query("token")})
+}
+
+// ResetPassword sets a new password using a reset token
+// @Summary Reset password
+// @Description Consume a password reset token and set a new password. Form posts from the reset page get the page back instead of JSON.
+// @Tags Authentication
+// @Accept json
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]interface{} "Password reset successfully"
+// @Failure 400 {object} utils.Problem "Invalid or expired reset token, or password policy violation"
+// @Failure 500 {object} utils.Problem "Failed to reset password"
+// @Router /password/reset [post]
+func ResetPassword(c *gin.Context) {
+	if c.ContentType() == binding.MIMEPOSTForm {
+		resetPasswordFromForm(c)
+		return
+	}
+
+	var req ResetPasswordRequest
+
+	// Bind JSON request body
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	if apiErr := resetPassword(c, req); apiErr != nil {
+		utils.AbortWithError(c, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset successfully",
+	})
+}
+
+// resetPasswordFromForm handles a submission of the reset page and renders the outcome
+func resetPasswordFromForm(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBind(&req); err != nil {
+		renderResetPasswordPage(c, http.StatusBadRequest, resetPasswordPageData{Token: req.Token, Error: "Enter a new password."})
+		return
+	}
+
+	apiErr := resetPassword(c, req)
+	if apiErr == nil {
+		renderResetPasswordPage(c, http.StatusOK, resetPasswordPageData{Done: true})
+		return
+	}
+	if apiErr.Status >= http.StatusInternalServerError {
+		utils.Logger(c.Request.Context()).Error("Failed to reset password", "error", apiErr)
+	}
+
+	page := resetPasswordPageData{Token: req.Token, Error: apiErr.Detail}
+	if violations, ok := apiErr.Extensions["violations"].([]utils.PasswordViolation); ok {
+		page.Violations = violations
+	}
+	renderResetPasswordPage(c, apiErr.Status, page)
+}
+
+// resetPassword consumes the reset token and stores the new password
+func resetPassword(c *gin.Context, req ResetPasswordRequest) *utils.APIError {
+	tokenHash := utils.HashToken(req.Token)
+
+	userID, err := models.GetPasswordResetTokenUser(c.Request.Context(), tokenHash)
+	if err != nil {
+		return utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidResetToken, "Invalid or expired reset token")
+	}
+	user, err := models.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		return utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidResetToken, "Invalid or expired reset token")
+	}
+
+	// Check the policy before consuming the token so a rejected password can be retried
+	if apiErr := passwordPolicyError(req.NewPassword, user.Username, user.FullName); apiErr != nil {
+		return apiErr
+	}
+
+	consumed, err := models.ConsumePasswordResetToken(c.Request.Context(), tokenHash)
+	if err != nil || !consumed {
+		return utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidResetToken, "Invalid or expired reset token")
+	}
+
+	hash, err := utils.HashPassword(c.Request.Context(), req.NewPassword)
+	if err == nil {
+		err = models.UpdatePasswordHash(c.Request.Context(), user.ID, hash)
+	}
+	if err != nil {
+		return modelError(err, "Failed to reset password", nil)
+	}
+
+	// The new password passed the breach check, so clear any earlier flag
+	if user.PasswordBreached {
+		if err := models.SetPasswordBreached(c.Request.Context(), user.ID, false); err != nil {
+			utils.Logger(c.Request.Context()).Error("Failed to clear password breach flag", "error", err)
+		}
+	}
+
+	// The account owner has proven access, so lift any lockout
+	clearLoginFailures(c.Request.Context(), user.Username)
+
+	// Sign out every device that may have been using the old password
+	if err := models.RevokeUserSessions(c.Request.Context(), user.ID); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to revoke sessions after password reset", "error", err)
+	}
+
+	entry := models.AuditLog{
+		Event:   models.AuditPasswordReset,
+		ActorID: user.ID,
+		Actor:   user.Username,
+		Target:  fmt.Sprintf("user:%d", user.ID),
+		IP:      c.ClientIP(),
+	}
+	if err := entry.Create(c.Request.Context()); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+	}
+
+	return nil
+}
+
+// renderResetPasswordPage writes the password reset page
+func renderResetPasswordPage(c *gin.Context, status int, data resetPasswordPageData) {
+	// The URL carries the reset token, so it must not leak through referrers or caches
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+
+	if err := resetPasswordPage.Execute(c.Writer, data); err != nil {
+		utils.Logger(c.Request.Context()).Error("Failed to render password reset page", "error", err)
+	}
+}
+
+// sendPasswordReset issues a reset token for the matching user and emails it.
+// Unknown accounts and accounts without an email address are silently ignored.
+func sendPasswordReset(ctx context.Context, username string, email string) {
+	var user *models.User
+	var err error
+	if email != "" {
+		user, err = models.GetUserByEmail(ctx, email)
+	} else {
+		user, err = models.GetUserByUsername(ctx, username)
+	}
+	if err != nil || user.Email == "" {
+		return
+	}
+
+	// Directory passwords can only be changed in LDAP
+	if user.AuthSource == models.AuthSourceLDAP {
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to generate reset token", "error", err)
+		return
+	}
+
+	ttl := utils.GetEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+	err = models.CreatePasswordResetToken(ctx, user.ID, utils.HashToken(token), ttl)
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to store reset token", "error", err)
+		return
+	}
+
+	// PASSWORD_RESET_URL points at a front-end page; the default is the built-in reset page
+	resetURL := utils.GetEnv("PASSWORD_RESET_URL", utils.GetEnv("APP_BASE_URL", "http://localhost:8080")+"/password/reset")
+	link := resetURL + "?token=" + url.QueryEscape(token)
+	msg := utils.MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Someone asked to reset the password for your account.\n"+
+			"Use this link within %s to choose a new password:\n\n%s\n\n"+
+			"Reset token: %s\n\n"+
+			"If you did not ask for this, you can ignore this email.\n",
+			user.FullName, ttl, link, token),
+	}
+
+	err = utils.GetMailer().Send(msg)
+	if err != nil {
+		utils.Logger(ctx).Error("Failed to send password reset email", "error", err)
+	}
+}
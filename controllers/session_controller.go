@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionResponse is a session as shown to its owner
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current" example:"true"`
+}
+
+// GetMySessions lists the current user's active sessions
+// @Summary List my sessions
+// @Description List the devices where the current user is logged in
+// @Tags Sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of sessions"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 500 {object} utils.Problem "Failed to retrieve sessions"
+// @Router /me/sessions [get]
+func GetMySessions(c *gin.Context) {
+	sessions, err := models.GetActiveSessionsByUser(c.Request.Context(), c.GetInt("user_id"))
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve sessions", nil))
+		return
+	}
+
+	// Mark the session making this request
+	currentID := c.GetString("session_id")
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = SessionResponse{Session: session, Current: session.ID == currentID}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": response,
+		"count":    len(response),
+	})
+}
+
+// RevokeMySession signs out one of the current user's sessions
+// @Summary Revoke my session
+// @Description Sign out a device. Tokens issued for the session stop working immediately.
+// @Tags Sessions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{} "Session revoked successfully"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Not allowed while impersonating"
+// @Failure 404 {object} utils.Problem "Session not found"
+// @Router /me/sessions/{id} [delete]
+func RevokeMySession(c *gin.Context) {
+	// Only sessions owned by the current user can be revoked here
+	err := models.RevokeSession(c.Request.Context(), c.Param("id"), c.GetInt("user_id"))
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to revoke session", utils.NewAPIError(http.StatusNotFound, utils.CodeSessionNotFound, "Session not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session revoked successfully",
+	})
+}
+
+// GetUserSessions lists a user's active sessions
+// @Summary List user sessions
+// @Description List the active sessions of any user (admin only)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "List of sessions"
+// @Failure 400 {object} utils.Problem "Invalid user ID"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 500 {object} utils.Problem "Failed to retrieve sessions"
+// @Router /admin/users/{id}/sessions [get]
+func GetUserSessions(c *gin.Context) {
+	// Get user ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+
+	sessions, err := models.GetActiveSessionsByUser(c.Request.Context(), id)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve sessions", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+		"count":    len(sessions),
+	})
+}
+
+// RevokeUserSession signs out any user's session
+// @Summary Revoke session
+// @Description Sign out any session (admin only). Tokens issued for the session stop working immediately.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{} "Session revoked successfully"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "Session not found"
+// @Router /admin/sessions/{id} [delete]
+func RevokeUserSession(c *gin.Context) {
+	err := models.RevokeSession(c.Request.Context(), c.Param("id"), 0)
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to revoke session", utils.NewAPIError(http.StatusNotFound, utils.CodeSessionNotFound, "Session not found")))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session revoked successfully",
+	})
+}
@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"simple-restful-api/models"
+	"simple-restful-api/utils"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -10,9 +14,11 @@ import (
 
 // CreateUserRequest represents the request body for creating a user
 type CreateUserRequest struct {
-	Username string `json:"username" binding:"required" example:"johndoe"`
-	Password string `json:"password" binding:"required" example:"password123"`
-	FullName string `json:"full_name" binding:"required" example:"John Doe"`
+	Username   string `json:"username" binding:"required" example:"johndoe"`
+	Password   string `json:"password" binding:"required" example:"BlueHarbor42"`
+	FullName   string `json:"full_name" binding:"required" example:"John Doe"`
+	Email      string `json:"email" binding:"omitempty,email" example:"john@example.com"` // required when ALLOW_UNVERIFIED_LOGIN=false
+	InviteCode string `json:"invite_code" example:"inv_4fQzR8kLm2Xc9VbN"`                 // required when REGISTRATION_MODE=invite
 }
 
 // UpdateUserRequest represents the request body for updating a user
@@ -20,28 +26,54 @@ type UpdateUserRequest struct {
 	Username string `json:"username" example:"johndoe_updated"`
 	Password string `json:"password" example:"newpassword123"`
 	FullName string `json:"full_name" example:"John Doe Updated"`
+	Email    string `json:"email" binding:"omitempty,email" example:"john.updated@example.com"`
+	Role     string `json:"role" example:"user"` // only admins may change roles
 }
 
 // CreateUser creates a new user
 // @Summary Create a new user
-// @Description Create a new user account (public endpoint)
+// @Description Create a new user account (public endpoint). Depending on REGISTRATION_MODE, registration is open, needs an invitation code or is closed.
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Param user body CreateUserRequest true "User creation data"
 // @Success 201 {object} map[string]interface{} "User created successfully"
-// @Failure 400 {object} map[string]interface{} "Invalid request format"
-// @Failure 500 {object} map[string]interface{} "Failed to create user"
+// @Failure 400 {object} utils.Problem "Invalid request format, password policy violation or invalid invitation code"
+// @Failure 403 {object} utils.Problem "Registration is closed or requires an invitation"
+// @Failure 409 {object} utils.Problem "Username or email address is already taken"
+// @Failure 422 {object} utils.Problem "A value is too long to store"
+// @Failure 500 {object} utils.Problem "Failed to create user"
+// @Failure 503 {object} utils.Problem "Database unavailable"
 // @Router /users [post]
 func CreateUser(c *gin.Context) {
 	var req CreateUserRequest
 
 	// Bind JSON request body
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	// Accounts must be able to verify an email address when login requires one
+	if req.Email == "" && verifiedEmailRequired() {
+		apiErr := utils.NewAPIError(http.StatusBadRequest, utils.CodeValidationFailed, "One or more fields are invalid")
+		apiErr.Fields = []utils.FieldError{{Field: "email", Rule: "required", Message: "is required"}}
+		utils.AbortWithError(c, apiErr)
+		return
+	}
+
+	mode := registrationMode(c.Request.Context())
+	if mode == RegistrationClosed {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeRegistrationClosed, "Registration is closed"))
+		return
+	}
+	if mode == RegistrationInvite && req.InviteCode == "" {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeInvitationRequired, "Registration requires an invitation code"))
+		return
+	}
+
+	// Enforce password policy
+	if !checkPasswordPolicy(c, req.Password, req.Username, req.FullName) {
 		return
 	}
 
@@ -50,18 +82,45 @@ func CreateUser(c *gin.Context) {
 		Username: req.Username,
 		Password: req.Password,
 		FullName: req.FullName,
+		Email:    req.Email,
 	}
 
-	// Save user to database
-	err := user.Create()
+	// Save user to database, redeeming the invitation when one is given
+	var err error
+	invitationID := 0
+	if req.InviteCode != "" {
+		invitationID, err = user.CreateWithInvitation(c.Request.Context(), utils.HashToken(req.InviteCode))
+	} else {
+		err = user.Create(c.Request.Context())
+	}
+	if errors.Is(err, models.ErrInvalidInvitation) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidInvitation, "Invalid or expired invitation code"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to create user",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, modelError(err, "Failed to create user", nil))
 		return
 	}
 
+	if invitationID != 0 {
+		entry := models.AuditLog{
+			Event:   models.AuditInvitationRedeem,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  fmt.Sprintf("invitation:%d", invitationID),
+			IP:      c.ClientIP(),
+			Details: "role: " + user.Role,
+		}
+		if err := entry.Create(c.Request.Context()); err != nil {
+			utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+		}
+	}
+
+	// Ask the user to confirm their email address
+	if user.Email != "" {
+		utils.RunInBackground(c.Request.Context(), func(ctx context.Context) { sendVerificationEmail(ctx, &user) })
+	}
+
 	// Return success response
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User created successfully",
@@ -71,25 +130,39 @@ func CreateUser(c *gin.Context) {
 
 // GetUsers retrieves all users
 // @Summary Get all users
-// @Description Retrieve a list of all users (protected endpoint)
+// @Description Retrieve a list of all users (admins and service credentials); regular users get only their own record
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Success 200 {object} map[string]interface{} "List of users"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 500 {object} map[string]interface{} "Failed to retrieve users"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 500 {object} utils.Problem "Failed to retrieve users"
 // @Router /users [get]
 func GetUsers(c *gin.Context) {
-	users, err := models.GetAllUsers()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to retrieve users",
-			"details": err.Error(),
+	// Regular users may only see their own record
+	role := c.GetString("role")
+	if role != models.RoleAdmin && role != models.RoleService {
+		user, err := models.GetUserByID(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			utils.AbortWithError(c, modelError(err, "Failed to retrieve users", nil))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"users": []models.User{*user},
+			"count": 1,
 		})
 		return
 	}
 
+	users, err := models.GetAllUsers(c.Request.Context())
+	if err != nil {
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve users", nil))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"users": users,
 		"count": len(users),
@@ -98,35 +171,33 @@ func GetUsers(c *gin.Context) {
 
 // GetUser retrieves a single user by ID
 // @Summary Get user by ID
-// @Description Retrieve a specific user by their ID (protected endpoint)
+// @Description Retrieve a specific user by their ID (own record only unless admin)
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
 // @Success 200 {object} map[string]interface{} "User details"
-// @Failure 400 {object} map[string]interface{} "Invalid user ID"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 400 {object} utils.Problem "Invalid user ID"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "User not found"
+// @Failure 503 {object} utils.Problem "Database unavailable"
 // @Router /users/{id} [get]
 func GetUser(c *gin.Context) {
 	// Get user ID from URL parameter
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid user ID",
-		})
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid user ID"))
 		return
 	}
 
 	// Get user from database
-	user, err := models.GetUserByID(id)
+	user, err := models.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "User not found",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve user", utils.NewAPIError(http.StatusNotFound, utils.CodeUserNotFound, "User not found")))
 		return
 	}
 
@@ -137,50 +208,73 @@ func GetUser(c *gin.Context) {
 
 // UpdateUser updates an existing user
 // @Summary Update user
-// @Description Update an existing user's information (protected endpoint)
+// @Description Update an existing user's information (own record only unless admin). Changing the password or role signs the user out of every session.
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
 // @Param user body UpdateUserRequest true "User update data"
 // @Success 200 {object} map[string]interface{} "User updated successfully"
-// @Failure 400 {object} map[string]interface{} "Invalid request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "User not found"
-// @Failure 500 {object} map[string]interface{} "Failed to update user"
+// @Failure 400 {object} utils.Problem "Invalid request or password policy violation"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "User not found"
+// @Failure 409 {object} utils.Problem "Username or email address is already taken"
+// @Failure 422 {object} utils.Problem "A value is too long to store"
+// @Failure 500 {object} utils.Problem "Failed to update user"
+// @Failure 503 {object} utils.Problem "Database unavailable"
 // @Router /users/{id} [put]
 func UpdateUser(c *gin.Context) {
 	// Get user ID from URL parameter
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid user ID",
-		})
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid user ID"))
 		return
 	}
 
 	// Check if user exists
-	existingUser, err := models.GetUserByID(id)
+	existingUser, err := models.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "User not found",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, modelError(err, "Failed to retrieve user", utils.NewAPIError(http.StatusNotFound, utils.CodeUserNotFound, "User not found")))
 		return
 	}
 
 	// Bind JSON request body
 	var req UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, utils.InvalidRequestError(err))
+		return
+	}
+
+	// Directory users are matched by username and check their password in LDAP
+	if existingUser.AuthSource == models.AuthSourceLDAP &&
+		(req.Password != "" || (req.Username != "" && req.Username != existingUser.Username)) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeDirectoryManaged, "Username and password of directory users are managed in LDAP"))
+		return
+	}
+
+	// Credentials stay with the account owner while an admin impersonates them
+	if isImpersonating(c) && (req.Password != "" || (req.Email != "" && req.Email != existingUser.Email)) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeImpersonationRestricted, "Password and email cannot be changed while impersonating a user"))
 		return
 	}
 
+	// Service credentials may manage profiles, but never credentials or admin
+	// accounts, which would let them take over an admin without the admin scope
+	if c.GetString("role") == models.RoleService {
+		if existingUser.Role == models.RoleAdmin {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeForbidden, "Service credentials cannot modify admin accounts"))
+			return
+		}
+		if req.Password != "" || (req.Email != "" && req.Email != existingUser.Email) {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeForbidden, "Service credentials cannot change passwords or email addresses"))
+			return
+		}
+	}
+
 	// Update user fields if provided
 	if req.Username != "" {
 		existingUser.Username = req.Username
@@ -188,20 +282,53 @@ func UpdateUser(c *gin.Context) {
 	if req.FullName != "" {
 		existingUser.FullName = req.FullName
 	}
+	emailChanged := req.Email != "" && req.Email != existingUser.Email
+	credentialsChanged := false
+	if emailChanged {
+		existingUser.Email = req.Email
+		existingUser.EmailVerified = false
+	}
 	if req.Password != "" {
+		// Check against the user details as they will be after the update
+		if !checkPasswordPolicy(c, req.Password, existingUser.Username, existingUser.FullName) {
+			return
+		}
 		existingUser.Password = req.Password
+		credentialsChanged = true
+	}
+	if req.Role != "" && req.Role != existingUser.Role {
+		// Only admins may grant or revoke roles
+		if c.GetString("role") != models.RoleAdmin {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeRoleChangeForbidden, "Only admins can change user roles"))
+			return
+		}
+		if !models.IsValidRole(req.Role) {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidRole, "Invalid role"))
+			return
+		}
+		existingUser.Role = req.Role
+		credentialsChanged = true
 	}
 
 	// Save updated user
-	err = existingUser.Update()
+	err = existingUser.Update(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to update user",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, modelError(err, "Failed to update user", nil))
 		return
 	}
 
+	// Tokens carry the role and were issued against the old password, so sign out every device
+	if credentialsChanged {
+		if err := models.RevokeUserSessions(c.Request.Context(), existingUser.ID); err != nil {
+			utils.Logger(c.Request.Context()).Error("Failed to revoke sessions after credential change", "error", err)
+		}
+	}
+
+	// A new email address must be verified again
+	if emailChanged {
+		utils.RunInBackground(c.Request.Context(), func(ctx context.Context) { sendVerificationEmail(ctx, existingUser) })
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User updated successfully",
 		"user":    existingUser,
@@ -210,35 +337,47 @@ func UpdateUser(c *gin.Context) {
 
 // DeleteUser deletes a user by ID
 // @Summary Delete user
-// @Description Delete a user by their ID (protected endpoint)
+// @Description Delete a user by their ID (own record only unless admin)
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
 // @Success 200 {object} map[string]interface{} "User deleted successfully"
-// @Failure 400 {object} map[string]interface{} "Invalid user ID"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 400 {object} utils.Problem "Invalid user ID"
+// @Failure 401 {object} utils.Problem "Unauthorized"
+// @Failure 403 {object} utils.Problem "Forbidden"
+// @Failure 404 {object} utils.Problem "User not found"
+// @Failure 500 {object} utils.Problem "Failed to delete user"
+// @Failure 503 {object} utils.Problem "Database unavailable"
 // @Router /users/{id} [delete]
 func DeleteUser(c *gin.Context) {
 	// Get user ID from URL parameter
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid user ID",
-		})
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusBadRequest, utils.CodeInvalidID, "Invalid user ID"))
 		return
 	}
 
+	// Service credentials cannot delete admin accounts
+	if c.GetString("role") == models.RoleService {
+		target, err := models.GetUserByID(c.Request.Context(), id)
+		if err != nil {
+			utils.AbortWithError(c, modelError(err, "Failed to delete user", utils.NewAPIError(http.StatusNotFound, utils.CodeUserNotFound, "User not found")))
+			return
+		}
+		if target.Role == models.RoleAdmin {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeForbidden, "Service credentials cannot delete admin accounts"))
+			return
+		}
+	}
+
 	// Delete user from database
-	err = models.DeleteUser(id)
+	err = models.DeleteUser(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "Failed to delete user",
-			"details": err.Error(),
-		})
+		utils.AbortWithError(c, modelError(err, "Failed to delete user", utils.NewAPIError(http.StatusNotFound, utils.CodeUserNotFound, "User not found")))
 		return
 	}
 
@@ -246,3 +385,24 @@ func DeleteUser(c *gin.Context) {
 		"message": "User deleted successfully",
 	})
 }
+
+// checkPasswordPolicy validates a new password against the password policy and
+// responds with every violated rule. It returns false when the password was rejected.
+func checkPasswordPolicy(c *gin.Context, password string, username string, fullName string) bool {
+	if apiErr := passwordPolicyError(password, username, fullName); apiErr != nil {
+		utils.AbortWithError(c, apiErr)
+		return false
+	}
+	return true
+}
+
+// passwordPolicyError returns the error listing every violated rule, or nil when the password is acceptable
+func passwordPolicyError(password string, username string, fullName string) *utils.APIError {
+	violations := utils.ValidatePasswordPolicy(password, username, fullName)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return utils.NewAPIError(http.StatusBadRequest, utils.CodePasswordPolicy,
+		"Password does not meet the password policy").With("violations", violations)
+}
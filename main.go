@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"simple-restful-api/controllers"
 	"simple-restful-api/middlewares"
 	"simple-restful-api/models"
+	"simple-restful-api/utils"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	_ "simple-restful-api/docs" // Auto-generated Swagger docs
 )
@@ -36,6 +44,11 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key for service-to-service access.
+
 func main() {
 	// Load environment variables
 	err := godotenv.Load()
@@ -43,6 +56,20 @@ func main() {
 		log.Println("Warning: Error loading .env file, using system environment variables")
 	}
 
+	// Structured logging; the standard log package writes through it as well
+	utils.InitLogger()
+
+	// Tracing must be set up before the database so SQL spans are exported
+	shutdownTracing, err := utils.InitTracing(context.Background())
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+
+	// Refuse to start with hashing parameters that would fail every login
+	if err := utils.ValidatePasswordHasher(); err != nil {
+		log.Fatal("Invalid password hashing configuration:", err)
+	}
+
 	// Initialize database connection
 	err = models.InitDB()
 	if err != nil {
@@ -50,24 +77,124 @@ func main() {
 	}
 	defer models.CloseDB()
 
-	// Create Gin router
-	router := gin.Default()
+	// Open the breached password corpus, building its index on first use
+	if err := utils.InitBreachedPasswords(); err != nil {
+		log.Fatal("Failed to load breached password corpus:", err)
+	}
+
+	// Create Gin router with request IDs, structured access logs and panic recovery
+	router := gin.New()
+	// otelgin comes first so the trace context from traceparent is available to everything after it
+	router.Use(otelgin.Middleware(utils.ServiceName))
+
+	// Only honour X-Forwarded-For from listed proxies, so clients cannot pick the
+	// IP that rate limits and login throttling count against
+	var trustedProxies []string
+	if value := utils.GetEnv("TRUSTED_PROXIES", ""); value != "" {
+		trustedProxies = strings.Split(value, ",")
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	router.Use(middlewares.RequestID(), middlewares.AccessLog(), middlewares.Metrics(), middlewares.Recovery())
+	// Errors recorded by handlers are written as application/problem+json
+	utils.UseJSONFieldNames()
+	router.Use(middlewares.ErrorHandler())
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(middlewares.NotFound())
+	router.NoMethod(middlewares.MethodNotAllowed())
+	// CORS answers preflight requests before rate limiting and authentication see them
+	router.Use(middlewares.SecurityHeaders(), middlewares.CORS())
+
+	// Prometheus metrics: on their own listener when METRICS_ADDR is set, otherwise
+	// on the API port but only when METRICS_TOKEN protects them
+	utils.RegisterDBStatsMetrics(models.DBStats)
+	metricsAddr := utils.GetEnv("METRICS_ADDR", "")
+	if metricsAddr == "" && utils.GetEnv("METRICS_TOKEN", "") != "" {
+		router.GET("/metrics", gin.WrapH(utils.MetricsHandler()))
+	}
+
+	// Health probes and build information
+	router.GET("/healthz", controllers.Healthz)
+	router.GET("/readyz", controllers.Readyz)
+	router.GET("/version", controllers.Version)
 
 	// Swagger documentation route
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/swagger/*any", middlewares.HTMLContentSecurityPolicy(), ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// Public routes (no authentication required)
-	router.POST("/login", controllers.Login)
-	router.POST("/users", controllers.CreateUser)
+	// Rate limit buckets live in memory unless RATE_LIMIT_STORE=database shares them across instances
+	var rateLimitStore utils.RateLimitStore = utils.NewMemoryRateLimitStore()
+	if utils.GetEnv("RATE_LIMIT_STORE", "memory") == "database" {
+		rateLimitStore = models.NewDBRateLimitStore()
+	}
 
-	// Protected routes (authentication required)
+	// Public routes (no authentication required), limited per client IP
+	public := router.Group("/")
+	public.Use(middlewares.RateLimit(rateLimitStore, "public", "60/1m"))
+	{
+		public.POST("/login", controllers.Login)
+		public.POST("/login/mfa", controllers.LoginMFA)
+		public.GET("/login/oidc", controllers.OIDCLogin)
+		public.GET("/login/oidc/callback", controllers.OIDCCallback)
+		public.POST("/users", middlewares.RateLimit(rateLimitStore, "register", "5/1h"), controllers.CreateUser)
+		public.POST("/password/forgot", controllers.ForgotPassword)
+		public.GET("/password/reset", controllers.ResetPasswordForm)
+		public.POST("/password/reset", controllers.ResetPassword)
+		public.GET("/verify-email", controllers.VerifyEmail)
+		public.POST("/verify-email/resend", controllers.ResendVerification)
+
+		// OAuth 2.0 authorization server
+		public.GET("/oauth/authorize", middlewares.HTMLContentSecurityPolicy(), controllers.OAuthAuthorize)
+		public.POST("/oauth/authorize", middlewares.HTMLContentSecurityPolicy(), controllers.OAuthAuthorizeSubmit)
+		public.POST("/oauth/token", controllers.OAuthToken)
+	}
+
+	// Protected routes (authentication required), limited per user or API key
 	protected := router.Group("/")
-	protected.Use(middlewares.AuthMiddleware())
+	protected.Use(middlewares.AuthMiddleware(), middlewares.AuditImpersonation(),
+		middlewares.RateLimit(rateLimitStore, "api", "300/1m"))
+	{
+		protected.GET("/users", middlewares.RequireScope(models.ScopeUsersRead), controllers.GetUsers)
+	}
+
+	// Per-user routes (own record only, unless admin)
+	userRoutes := protected.Group("/users/:id")
+	userRoutes.Use(middlewares.RequireSelfOrAdmin("id"))
+	{
+		userRoutes.GET("", controllers.GetUser)
+		userRoutes.PUT("", controllers.UpdateUser)
+		userRoutes.DELETE("", middlewares.DenyImpersonation(), controllers.DeleteUser)
+	}
+
+	// Current user routes (user logins only)
+	me := protected.Group("/me")
+	me.Use(middlewares.RequireUser(), middlewares.RequireScope(models.ScopeAccount))
+	{
+		me.POST("/mfa/enroll", middlewares.DenyImpersonation(), controllers.EnrollMFA)
+		me.POST("/mfa/confirm", middlewares.DenyImpersonation(), controllers.ConfirmMFA)
+		me.DELETE("/mfa", middlewares.DenyImpersonation(), controllers.DisableMFA)
+		me.GET("/sessions", controllers.GetMySessions)
+		me.DELETE("/sessions/:id", middlewares.DenyImpersonation(), controllers.RevokeMySession)
+	}
+
+	// Admin routes
+	admin := protected.Group("/admin")
+	admin.Use(middlewares.RequireRole(models.RoleAdmin), middlewares.RequireScope(models.ScopeAdmin))
 	{
-		protected.GET("/users", controllers.GetUsers)
-		protected.GET("/users/:id", controllers.GetUser)
-		protected.PUT("/users/:id", controllers.UpdateUser)
-		protected.DELETE("/users/:id", controllers.DeleteUser)
+		admin.POST("/api-keys", controllers.CreateAPIKey)
+		admin.GET("/api-keys", controllers.GetAPIKeys)
+		admin.DELETE("/api-keys/:id", controllers.RevokeAPIKey)
+		admin.GET("/lockouts", controllers.GetLoginLockouts)
+		admin.POST("/lockouts/unlock", controllers.UnlockLogin)
+		admin.GET("/users/:id/sessions", controllers.GetUserSessions)
+		admin.DELETE("/sessions/:id", controllers.RevokeUserSession)
+		admin.POST("/oauth/clients", controllers.CreateOAuthClient)
+		admin.GET("/oauth/clients", controllers.GetOAuthClients)
+		admin.DELETE("/oauth/clients/:id", controllers.RevokeOAuthClient)
+		admin.POST("/impersonate/:id", controllers.ImpersonateUser)
+		admin.POST("/invitations", controllers.CreateInvitation)
+		admin.GET("/invitations", controllers.GetInvitations)
+		admin.DELETE("/invitations/:id", controllers.RevokeInvitation)
 	}
 
 	// Get port from environment variable
@@ -76,7 +203,94 @@ func main() {
 		port = "8080" // Default port
 	}
 
-	// Start server
-	log.Printf("Server starting on port %s...", port)
-	router.Run(":" + port)
+	// Serve HTTPS when a certificate is configured (or self-signed in development)
+	tlsConfig, err := utils.GetTLSConfig()
+	if err != nil {
+		log.Fatal("Invalid TLS configuration:", err)
+	}
+
+	// Start server with explicit timeouts so slow clients cannot hold connections open
+	server := utils.NewHTTPServer(":"+port, router)
+	server.TLSConfig = tlsConfig
+	serverErr := make(chan error, 3)
+	go func() {
+		if tlsConfig != nil {
+			log.Printf("Server starting on port %s (HTTPS)...", port)
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("Server starting on port %s...", port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Optionally send plain HTTP clients to the HTTPS port
+	var redirectServer *http.Server
+	if addr := utils.GetEnv("TLS_REDIRECT_ADDR", ""); addr != "" && tlsConfig != nil {
+		redirectServer = utils.NewRedirectServer(addr, port)
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", addr)
+			serverErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	var metricsServer *http.Server
+	if metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", utils.MetricsHandler())
+		metricsServer = utils.NewHTTPServer(metricsAddr, mux)
+		go func() {
+			log.Printf("Serving metrics on %s", metricsAddr)
+			serverErr <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	// Wait for a shutdown signal (Ctrl+C locally, SIGTERM from the orchestrator)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		models.CloseDB()
+		log.Fatal("Server failed:", err)
+	case <-ctx.Done():
+		// A second signal now terminates immediately
+		stop()
+	}
+
+	// Fail readiness first and give load balancers time to notice before
+	// the listener closes
+	utils.BeginShutdown()
+	if delay := utils.GetEnvDuration("SHUTDOWN_READINESS_DELAY", 0); delay > 0 {
+		log.Printf("Readiness now failing, waiting %s before shutting down...", delay)
+		time.Sleep(delay)
+	}
+
+	// Stop accepting connections and let in-flight requests finish within the deadline
+	timeout := utils.GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	log.Printf("Shutting down, waiting up to %s for in-flight requests...", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Forced shutdown, some requests were cut off: %v", err)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+
+	// Background work such as outgoing email still needs the database
+	if err := utils.WaitForBackgroundTasks(shutdownCtx); err != nil {
+		log.Printf("Background tasks did not finish before the deadline: %v", err)
+	}
+
+	// Flush spans that are still buffered
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
+	// The deferred CloseDB closes the database pool after this point
+	log.Println("Server stopped")
 }
@@ -1,51 +1,181 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"simple-restful-api/models"
 	"simple-restful-api/utils"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// AuthMiddleware validates JWT token and adds user info to context
+// AuthMiddleware validates JWT token or API key and adds caller info to context
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header required",
-			})
-			c.Abort()
-			return
+		// Validation gets its own span, so slow token, session or API key checks
+		// stand out, and the lookups it makes are traced beneath it
+		request := c.Request
+		ctx, span := utils.Tracer.Start(request.Context(), "auth.validate")
+		c.Request = request.WithContext(ctx)
+
+		ok := authenticate(c)
+
+		span.SetAttributes(
+			attribute.String("auth.method", c.GetString("auth_method")),
+			attribute.Bool("auth.success", ok))
+		span.End()
+		c.Request = request
+
+		if ok {
+			c.Next()
+		}
+	}
+}
+
+// authenticate validates the request's credentials and adds the caller's
+// identity to the context. On failure it aborts with 401 and returns false.
+func authenticate(c *gin.Context) bool {
+	// Get Authorization header
+	authHeader := c.GetHeader("Authorization")
+
+	// API keys may be sent as "Authorization: ApiKey <key>" or "X-API-Key: <key>"
+	apiKey := utils.ExtractAPIKeyFromHeader(authHeader)
+	if apiKey == "" {
+		apiKey = c.GetHeader("X-API-Key")
+	}
+	if apiKey != "" {
+		return authenticateAPIKey(c, apiKey)
+	}
+
+	if authHeader == "" {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeAuthRequired, "Authorization header required"))
+		return false
+	}
+
+	// Extract token from Bearer format
+	token := utils.ExtractTokenFromHeader(authHeader)
+	if token == "" {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeAuthRequired, "Bearer token required"))
+		return false
+	}
+
+	// Validate token
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidToken, "Invalid or expired token").WithCause(err))
+		return false
+	}
+
+	// Tokens tied to a session stop working as soon as the session is revoked
+	if claims.SessionID != "" {
+		session, err := models.GetSessionByID(c.Request.Context(), claims.SessionID)
+		if lookupFailed(c, err) {
+			return false
+		}
+		if err != nil || !session.IsActive() || session.UserID != claims.UserID {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeSessionRevoked, "Session has been revoked or has expired"))
+			return false
+		}
+
+		// Record activity without delaying the request
+		sessionID := session.ID
+		utils.RunInBackground(c.Request.Context(), func(ctx context.Context) {
+			if err := models.TouchSession(ctx, sessionID, time.Minute); err != nil {
+				utils.Logger(ctx).Error("Failed to update session last-seen time", "error", err)
+			}
+		})
+
+		c.Set("session_id", session.ID)
+	}
+
+	// Add user info to context for use in handlers
+	c.Set("auth_method", "jwt")
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+
+	// Impersonation tokens also carry the admin, whose own session must still be active
+	if claims.Actor != nil {
+		if claims.Actor.SessionID != "" {
+			session, err := models.GetSessionByID(c.Request.Context(), claims.Actor.SessionID)
+			if lookupFailed(c, err) {
+				return false
+			}
+			if err != nil || !session.IsActive() || session.UserID != claims.Actor.UserID {
+				utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeSessionRevoked, "Impersonating admin's session has been revoked or has expired"))
+				return false
+			}
 		}
 
-		// Extract token from Bearer format
-		token := utils.ExtractTokenFromHeader(authHeader)
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Bearer token required",
-			})
-			c.Abort()
-			return
+		c.Set("actor_id", claims.Actor.UserID)
+		c.Set("actor_username", claims.Actor.Username)
+	}
+
+	// Tokens issued through OAuth are limited to the scopes granted to the client
+	if claims.ClientID != "" {
+		// Revoking a client stops every token it issued, with or without a session
+		client, err := models.GetOAuthClientByClientID(c.Request.Context(), claims.ClientID)
+		if lookupFailed(c, err) {
+			return false
+		}
+		if err != nil || !client.IsActive() {
+			utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeOAuthClientRevoked, "OAuth client has been revoked"))
+			return false
 		}
 
-		// Validate token
-		claims, err := utils.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Invalid or expired token",
-				"details": err.Error(),
-			})
-			c.Abort()
-			return
+		c.Set("auth_method", "oauth")
+		c.Set("client_id", claims.ClientID)
+		c.Set("scopes", strings.Fields(claims.Scope))
+	}
+
+	return true
+}
+
+// authenticateAPIKey validates an API key and adds its identity and scopes to context
+func authenticateAPIKey(c *gin.Context, apiKey string) bool {
+	key, err := models.GetAPIKeyByHash(c.Request.Context(), utils.HashAPIKey(apiKey))
+	if lookupFailed(c, err) {
+		return false
+	}
+	if err != nil || !key.IsActive() {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusUnauthorized, utils.CodeInvalidAPIKey, "Invalid, expired or revoked API key"))
+		return false
+	}
+
+	// Record usage without delaying the request
+	keyID := key.ID
+	utils.RunInBackground(c.Request.Context(), func(ctx context.Context) {
+		if err := models.TouchAPIKey(ctx, keyID); err != nil {
+			utils.Logger(ctx).Error("Failed to record API key usage", "error", err)
 		}
+	})
 
-		// Add user info to context for use in handlers
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
+	// API keys act as a service principal limited to their scopes
+	c.Set("auth_method", "api_key")
+	c.Set("api_key_id", key.ID)
+	c.Set("username", "apikey:"+key.Name)
+	c.Set("role", models.RoleService)
+	c.Set("scopes", key.Scopes)
+
+	return true
+}
+
+// lookupFailed aborts the request when a credential could not be checked because
+// of a database failure, which says nothing about whether the credential is valid.
+// A missing record is left for the caller to reject.
+func lookupFailed(c *gin.Context, err error) bool {
+	if err == nil || errors.Is(err, models.ErrNotFound) {
+		return false
+	}
 
-		// Continue to next handler
-		c.Next()
+	if errors.Is(err, models.ErrUnavailable) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusServiceUnavailable, utils.CodeServiceUnavailable, "The database is unavailable, try again later").WithCause(err))
+	} else {
+		utils.AbortWithError(c, utils.InternalError("Failed to check credentials", err))
 	}
+	return true
 }
@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"log/slog"
+	"net/http"
+	"simple-restful-api/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS lets browser apps on the origins in CORS_ALLOWED_ORIGINS call the API.
+// "*" allows any origin but cannot be combined with CORS_ALLOW_CREDENTIALS.
+// Preflight requests are answered here, before routing and authentication,
+// and may be cached by the browser for CORS_MAX_AGE. With no allowed origins
+// the middleware does nothing and browsers apply the same-origin policy.
+func CORS() gin.HandlerFunc {
+	origins := splitList(utils.GetEnv("CORS_ALLOWED_ORIGINS", ""))
+	if len(origins) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	allowed := make(map[string]bool, len(origins))
+	anyOrigin := false
+	for _, origin := range origins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	credentials := utils.GetEnvBool("CORS_ALLOW_CREDENTIALS", false)
+	if credentials && anyOrigin {
+		slog.Warn("CORS_ALLOW_CREDENTIALS is ignored when CORS_ALLOWED_ORIGINS contains *")
+		credentials = false
+	}
+
+	methods := strings.Join(splitList(utils.GetEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE")), ", ")
+	headers := strings.Join(splitList(utils.GetEnv("CORS_ALLOWED_HEADERS",
+		"Authorization,Content-Type,X-API-Key,"+RequestIDHeader)), ", ")
+	exposed := strings.Join(splitList(utils.GetEnv("CORS_EXPOSED_HEADERS",
+		RequestIDHeader+",RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy,Retry-After")), ", ")
+	maxAge := strconv.Itoa(int(utils.GetEnvDuration("CORS_MAX_AGE", 10*time.Minute).Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		// Responses differ by origin, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if origin == "" || !(anyOrigin || allowed[origin]) {
+			if preflight && origin != "" {
+				utils.AbortWithError(c, utils.NewAPIError(http.StatusForbidden, utils.CodeOriginNotAllowed, "Origin not allowed"))
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if anyOrigin {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", exposed)
+		c.Next()
+	}
+}
+
+// splitList splits a comma-separated setting, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
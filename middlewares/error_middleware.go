@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"simple-restful-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of error responses (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// ErrorHandler writes the error recorded with utils.AbortWithError, or c.Error,
+// as an RFC 7807 problem once the handlers have run. Errors other than
+// *utils.APIError become a generic 500 so that their text, which may come from
+// the database driver, is only seen in the access log.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		var apiErr *utils.APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = utils.InternalError("An unexpected error occurred", err)
+		}
+		writeProblem(c, apiErr)
+	}
+}
+
+// NotFound answers requests that match no route
+func NotFound() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusNotFound, utils.CodeNotFound, "No route matches "+c.Request.URL.Path))
+	}
+}
+
+// MethodNotAllowed answers requests whose path exists for other methods only
+func MethodNotAllowed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.AbortWithError(c, utils.NewAPIError(http.StatusMethodNotAllowed, utils.CodeMethodNotAllowed,
+			c.Request.Method+" is not supported for "+c.Request.URL.Path))
+	}
+}
+
+// writeProblem sends apiErr as application/problem+json, with its extension
+// members next to the standard ones
+func writeProblem(c *gin.Context, apiErr *utils.APIError) {
+	problem := apiErr.Problem(c.Request.URL.Path, c.GetString("request_id"))
+
+	body := gin.H{}
+	for key, value := range apiErr.Extensions {
+		body[key] = value
+	}
+	body["type"] = problem.Type
+	body["title"] = problem.Title
+	body["status"] = problem.Status
+	body["detail"] = problem.Detail
+	body["instance"] = problem.Instance
+	body["code"] = problem.Code
+	body["request_id"] = problem.RequestID
+	if len(problem.Errors) > 0 {
+		body["errors"] = problem.Errors
+	}
+
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(apiErr.Status, body)
+}
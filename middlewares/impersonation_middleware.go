@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"simple-restful-api/models"
+	"simple-restful-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditImpersonation records every request that changes data while an admin
+// impersonates a user, naming both the admin and the user. Reads are not recorded.
+// It must run after AuthMiddleware.
+func AuditImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetInt("actor_id")
+		method := c.Request.Method
+		if actorID == 0 || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		utils.Logger(c.Request.Context()).Info("Impersonated request",
+			"actor_id", actorID, "actor", c.GetString("actor_username"), "user_id", c.GetInt("user_id"),
+			"username", c.GetString("username"), "method", method, "path", c.Request.URL.Path, "status", c.Writer.Status())
+
+		entry := models.AuditLog{
+			Event:   models.AuditImpersonationAction,
+			ActorID: actorID,
+			Actor:   c.GetString("actor_username"),
+			Target:  fmt.Sprintf("user:%d", c.GetInt("user_id")),
+			IP:      c.ClientIP(),
+			Details: fmt.Sprintf("%s %s -> %d", method, c.Request.URL.Path, c.Writer.Status()),
+		}
+		if err := entry.Create(c.Request.Context()); err != nil {
+			utils.Logger(c.Request.Context()).Error("Failed to write audit log", "error", err)
+		}
+	}
+}
+
+// DenyImpersonation rejects the request while an admin impersonates a user.
+// Use it for actions only the real account owner may take, such as managing MFA.
+// It must run after AuthMiddleware.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt("actor_id") != 0 {
+			denyAccess(c, "this action is not allowed while impersonating a user")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"simple-restful-api/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the request count and latency for each gin route template.
+// Requests that match no route share the "unmatched" label so arbitrary paths
+// cannot create new time series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		utils.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		utils.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
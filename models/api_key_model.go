@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIKey represents a credential used by services instead of a user login
+type APIKey struct {
+	ID         int        `json:"id" example:"1"`
+	Name       string     `json:"name" example:"nightly-report"`
+	Prefix     string     `json:"prefix" example:"sra_Xq3d9LkP"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes" example:"users:read"`
+	CreatedBy  int        `json:"created_by" example:"1"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Scopes that can be granted to API keys and OAuth clients
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	ScopeAccount    = "account" // the caller's own MFA and sessions (/me)
+	ScopeAdmin      = "admin"   // admin routes, still subject to the admin role
+)
+
+// IsValidScope reports whether scope is one of the known scopes
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeUsersRead, ScopeUsersWrite, ScopeAccount, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// IsActive reports whether the key is neither revoked nor expired
+func (k *APIKey) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	if k.ExpiresAt != nil && time.Now().UTC().After(*k.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// Create stores a new API key. KeyHash must already be set by the caller.
+func (k *APIKey) Create(ctx context.Context) error {
+	query := `INSERT INTO api_keys (name, key_prefix, key_hash, scopes, created_by, expires_at)
+		OUTPUT INSERTED.id, INSERTED.created_at
+		VALUES (@name, @prefix, @hash, @scopes, @createdby, @expiresat)`
+
+	var expiresAt sql.NullTime
+	if k.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: k.ExpiresAt.UTC(), Valid: true}
+	}
+
+	err := db.QueryRowContext(ctx, query,
+		sql.Named("name", k.Name),
+		sql.Named("prefix", k.Prefix),
+		sql.Named("hash", k.KeyHash),
+		sql.Named("scopes", strings.Join(k.Scopes, " ")),
+		sql.Named("createdby", k.CreatedBy),
+		sql.Named("expiresat", expiresAt)).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return dbError("error creating api key", err)
+	}
+
+	return nil
+}
+
+// GetAllAPIKeys retrieves all API keys, including revoked ones
+func GetAllAPIKeys(ctx context.Context) ([]APIKey, error) {
+	query := `SELECT id, name, key_prefix, key_hash, scopes, ISNULL(created_by, 0), created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys ORDER BY id`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, dbError("error querying api keys", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the SHA-256 hash of its secret
+func GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	query := `SELECT id, name, key_prefix, key_hash, scopes, ISNULL(created_by, 0), created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys WHERE key_hash = @hash`
+	row := db.QueryRowContext(ctx, query, sql.Named("hash", hash))
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api key %w", ErrNotFound)
+		}
+		return nil, dbError("error querying api key", err)
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey marks an API key as revoked so it can no longer authenticate
+func RevokeAPIKey(ctx context.Context, id int) error {
+	query := "UPDATE api_keys SET revoked_at = SYSUTCDATETIME() WHERE id = @id AND revoked_at IS NULL"
+	result, err := db.ExecContext(ctx, query, sql.Named("id", id))
+	if err != nil {
+		return dbError("error revoking api key", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return dbError("error getting rows affected", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("api key %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// TouchAPIKey records that an API key has just been used
+func TouchAPIKey(ctx context.Context, id int) error {
+	query := "UPDATE api_keys SET last_used_at = SYSUTCDATETIME() WHERE id = @id"
+	_, err := db.ExecContext(ctx, query, sql.Named("id", id))
+	if err != nil {
+		return dbError("error updating api key usage", err)
+	}
+
+	return nil
+}
+
+// scanAPIKey reads an api_keys row in the column order used by the queries above
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy,
+		&key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, dbError("error scanning api key", err)
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+
+	return &key, nil
+}
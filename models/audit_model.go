@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AuditLog represents a security-relevant event
+type AuditLog struct {
+	ID        int       `json:"id" example:"1"`
+	Event     string    `json:"event" example:"login.lockout"`
+	ActorID   int       `json:"actor_id,omitempty" example:"1"`
+	Actor     string    `json:"actor,omitempty" example:"admin"`
+	Target    string    `json:"target,omitempty" example:"user:johndoe"`
+	IP        string    `json:"ip,omitempty" example:"192.0.2.10"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Audit event names
+const (
+	AuditLoginLockout     = "login.lockout"
+	AuditLoginUnlock      = "login.unlock"
+	AuditPasswordReset    = "password.reset"
+	AuditPasswordBreached = "password.breached"
+	AuditOAuthConsent     = "oauth.consent"
+	AuditOIDCLink         = "oidc.link"
+	AuditOIDCProvision    = "oidc.provision"
+
+	AuditImpersonationStart  = "impersonation.start"
+	AuditImpersonationAction = "impersonation.action"
+
+	AuditInvitationCreate = "invitation.create"
+	AuditInvitationRevoke = "invitation.revoke"
+	AuditInvitationRedeem = "invitation.redeem"
+)
+
+// Create stores an audit log entry
+func (a *AuditLog) Create(ctx context.Context) error {
+	query := `INSERT INTO audit_logs (event, actor_id, actor, target, ip, details)
+		OUTPUT INSERTED.id, INSERTED.created_at
+		VALUES (@event, @actorid, @actor, @target, @ip, @details)`
+
+	err := db.QueryRowContext(ctx, query,
+		sql.Named("event", a.Event),
+		sql.Named("actorid", sql.NullInt64{Int64: int64(a.ActorID), Valid: a.ActorID != 0}),
+		sql.Named("actor", nullString(a.Actor)),
+		sql.Named("target", nullString(a.Target)),
+		sql.Named("ip", nullString(a.IP)),
+		sql.Named("details", nullString(a.Details))).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return dbError("error creating audit log", err)
+	}
+
+	return nil
+}
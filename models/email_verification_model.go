@@ -0,0 +1,45 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MarkEmailVerified marks a user's email address as verified. It returns false
+// when the user no longer has that address, e.g. because it changed after the
+// verification link was sent.
+func MarkEmailVerified(ctx context.Context, userID int, email string) (bool, error) {
+	query := `UPDATE users SET email_verified_at = ISNULL(email_verified_at, SYSUTCDATETIME())
+		WHERE id = @id AND email = @email`
+	result, err := db.ExecContext(ctx, query, sql.Named("id", userID), sql.Named("email", email))
+	if err != nil {
+		return false, dbError("error verifying email", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, dbError("error getting rows affected", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// ReserveVerificationEmail records that a verification email is about to be sent.
+// It returns false when one was already sent within the cooldown period.
+func ReserveVerificationEmail(ctx context.Context, userID int, cooldown time.Duration) (bool, error) {
+	query := `UPDATE users SET verification_sent_at = SYSUTCDATETIME()
+		WHERE id = @id AND email_verified_at IS NULL
+		AND (verification_sent_at IS NULL OR verification_sent_at < DATEADD(SECOND, -@cooldown, SYSUTCDATETIME()))`
+	result, err := db.ExecContext(ctx, query, sql.Named("id", userID), sql.Named("cooldown", int(cooldown.Seconds())))
+	if err != nil {
+		return false, dbError("error recording verification email", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, dbError("error getting rows affected", err)
+	}
+
+	return rowsAffected == 1, nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// Errors returned by the models wrap one of these sentinels when the cause is
+// known, so callers can branch with errors.Is. The driver error stays in the
+// chain for logging.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrValidation  = errors.New("invalid value")
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// Conflicts on the users table, told apart by the violated constraint
+var (
+	ErrUsernameTaken = fmt.Errorf("username is already taken: %w", ErrConflict)
+	ErrEmailTaken    = fmt.Errorf("email address is already in use: %w", ErrConflict)
+)
+
+// SQL Server error numbers that dbError classifies
+const (
+	mssqlUniqueConstraint = 2627 // violation of a PRIMARY KEY or UNIQUE constraint
+	mssqlUniqueIndex      = 2601 // duplicate key in a unique index
+	mssqlConstraint       = 547  // FOREIGN KEY or CHECK constraint
+	mssqlTruncation       = 2628 // string or binary data would be truncated
+	mssqlTruncationLegacy = 8152
+	mssqlDeadlock         = 1205
+	mssqlLoginFailed      = 18456
+	mssqlCannotOpenDB     = 4060
+)
+
+// dbError describes a failed database call, adding the matching sentinel to the
+// chain when the driver error is a constraint violation or a connection problem
+func dbError(action string, err error) error {
+	if kind := classifyDBError(err); kind != nil {
+		return fmt.Errorf("%s: %w: %w", action, kind, err)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// classifyDBError returns the sentinel for a driver error, or nil
+func classifyDBError(err error) error {
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) {
+		switch sqlErr.Number {
+		case mssqlUniqueConstraint, mssqlUniqueIndex:
+			return ErrConflict
+		case mssqlConstraint:
+			// Deleting a row that others still reference conflicts with them;
+			// a failed FOREIGN KEY or CHECK on insert or update is an invalid value
+			if strings.Contains(sqlErr.Message, "REFERENCE constraint") {
+				return ErrConflict
+			}
+			return ErrValidation
+		case mssqlTruncation, mssqlTruncationLegacy:
+			return ErrValidation
+		case mssqlDeadlock, mssqlLoginFailed, mssqlCannotOpenDB:
+			return ErrUnavailable
+		}
+		return nil
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// userDBError is dbError for writes to the users table, telling a taken
+// username from a taken email address
+func userDBError(action string, err error) error {
+	var sqlErr mssql.Error
+	if !errors.As(err, &sqlErr) || (sqlErr.Number != mssqlUniqueConstraint && sqlErr.Number != mssqlUniqueIndex) {
+		return dbError(action, err)
+	}
+
+	taken := ErrUsernameTaken
+	if strings.Contains(sqlErr.Message, "UX_users_email") {
+		taken = ErrEmailTaken
+	}
+	return fmt.Errorf("%s: %w: %w", action, taken, err)
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"simple-restful-api/utils"
+	"time"
+)
+
+// ErrInvalidInvitation is returned when an invitation code is unknown, revoked,
+// expired or has no uses left
+var ErrInvalidInvitation = errors.New("invalid, expired or fully used invitation code")
+
+// Invitation is a code that lets someone register while registration is invite-only
+type Invitation struct {
+	ID        int        `json:"id" example:"1"`
+	Prefix    string     `json:"prefix" example:"inv_4fQz"`
+	CodeHash  string     `json:"-"`
+	Role      string     `json:"role" example:"user"`
+	Note      string     `json:"note,omitempty" example:"New support staff"`
+	MaxUses   int        `json:"max_uses" example:"1"`
+	UseCount  int        `json:"use_count" example:"0"`
+	CreatedBy int        `json:"created_by" example:"1"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// InvitationRedemption records which account was created with an invitation
+type InvitationRedemption struct {
+	UserID     int       `json:"user_id" example:"7"`
+	Username   string    `json:"username" example:"johndoe"`
+	RedeemedAt time.Time `json:"redeemed_at"`
+}
+
+// IsActive reports whether the invitation can still be redeemed
+func (i *Invitation) IsActive() bool {
+	if i.RevokedAt != nil || i.UseCount >= i.MaxUses {
+		return false
+	}
+	if i.ExpiresAt != nil && time.Now().UTC().After(*i.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// Create stores a new invitation. CodeHash must already be set by the caller.
+func (i *Invitation) Create(ctx context.Context) error {
+	query := `INSERT INTO invitations (code_prefix, code_hash, role, note, max_uses, created_by, expires_at)
+		OUTPUT INSERTED.id, INSERTED.created_at
+		VALUES (@prefix, @hash, @role, @note, @maxuses, @createdby, @expiresat)`
+
+	var expiresAt sql.NullTime
+	if i.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: i.ExpiresAt.UTC(), Valid: true}
+	}
+
+	err := db.QueryRowContext(ctx, query,
+		sql.Named("prefix", i.Prefix),
+		sql.Named("hash", i.CodeHash),
+		sql.Named("role", i.Role),
+		sql.Named("note", nullString(i.Note)),
+		sql.Named("maxuses", i.MaxUses),
+		sql.Named("createdby", i.CreatedBy),
+		sql.Named("expiresat", expiresAt)).Scan(&i.ID, &i.CreatedAt)
+	if err != nil {
+		return dbError("error creating invitation", err)
+	}
+
+	return nil
+}
+
+// GetAllInvitations retrieves all invitations, including revoked and used ones
+func GetAllInvitations(ctx context.Context) ([]Invitation, error) {
+	query := `SELECT id, code_prefix, code_hash, role, ISNULL(note, ''), max_uses, use_count,
+		ISNULL(created_by, 0), created_at, expires_at, revoked_at
+		FROM invitations ORDER BY id`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, dbError("error querying invitations", err)
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		var expiresAt, revokedAt sql.NullTime
+		err := rows.Scan(&invitation.ID, &invitation.Prefix, &invitation.CodeHash, &invitation.Role,
+			&invitation.Note, &invitation.MaxUses, &invitation.UseCount, &invitation.CreatedBy,
+			&invitation.CreatedAt, &expiresAt, &revokedAt)
+		if err != nil {
+			return nil, dbError("error scanning invitation", err)
+		}
+		invitation.ExpiresAt = nullTimePtr(expiresAt)
+		invitation.RevokedAt = nullTimePtr(revokedAt)
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, nil
+}
+
+// GetInvitationRedemptions lists the accounts created with an invitation
+func GetInvitationRedemptions(ctx context.Context, invitationID int) ([]InvitationRedemption, error) {
+	query := `SELECT r.user_id, u.username, r.redeemed_at
+		FROM invitation_redemptions r JOIN users u ON u.id = r.user_id
+		WHERE r.invitation_id = @id ORDER BY r.redeemed_at`
+	rows, err := db.QueryContext(ctx, query, sql.Named("id", invitationID))
+	if err != nil {
+		return nil, dbError("error querying invitation redemptions", err)
+	}
+	defer rows.Close()
+
+	redemptions := []InvitationRedemption{}
+	for rows.Next() {
+		var r InvitationRedemption
+		if err := rows.Scan(&r.UserID, &r.Username, &r.RedeemedAt); err != nil {
+			return nil, dbError("error scanning invitation redemption", err)
+		}
+		redemptions = append(redemptions, r)
+	}
+
+	return redemptions, nil
+}
+
+// RevokeInvitation marks an invitation as revoked so it can no longer be redeemed
+func RevokeInvitation(ctx context.Context, id int) error {
+	query := "UPDATE invitations SET revoked_at = SYSUTCDATETIME() WHERE id = @id AND revoked_at IS NULL"
+	result, err := db.ExecContext(ctx, query, sql.Named("id", id))
+	if err != nil {
+		return dbError("error revoking invitation", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return dbError("error getting rows affected", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("invitation %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// CreateWithInvitation redeems an invitation and creates the user in one
+// transaction, giving the user the invitation's role. The use is counted
+// atomically, so concurrent registrations cannot exceed max_uses. It returns
+// the invitation ID, or ErrInvalidInvitation when the code cannot be redeemed.
+func (u *User) CreateWithInvitation(ctx context.Context, codeHash string) (int, error) {
+	hashedPassword, err := utils.HashPassword(ctx, u.Password)
+	if err != nil {
+		return 0, fmt.Errorf("error hashing password: %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, dbError("error starting transaction", err)
+	}
+	defer tx.Rollback()
+
+	var invitationID int
+	err = tx.QueryRowContext(ctx, `UPDATE invitations SET use_count = use_count + 1
+		OUTPUT INSERTED.id, INSERTED.role
+		WHERE code_hash = @hash AND revoked_at IS NULL AND use_count < max_uses
+			AND (expires_at IS NULL OR expires_at > SYSUTCDATETIME())`,
+		sql.Named("hash", codeHash)).Scan(&invitationID, &u.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidInvitation
+		}
+		return 0, dbError("error redeeming invitation", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO users (username, password, full_name, email, role)
+		OUTPUT INSERTED.id VALUES (@username, @password, @fullname, @email, @role)`,
+		sql.Named("username", u.Username),
+		sql.Named("password", hashedPassword),
+		sql.Named("fullname", u.FullName),
+		sql.Named("email", nullString(u.Email)),
+		sql.Named("role", u.Role)).Scan(&u.ID)
+	if err != nil {
+		return 0, userDBError("error creating user", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO invitation_redemptions (invitation_id, user_id) VALUES (@invitationid, @userid)",
+		sql.Named("invitationid", invitationID),
+		sql.Named("userid", u.ID))
+	if err != nil {
+		return 0, dbError("error recording invitation redemption", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, dbError("error committing transaction", err)
+	}
+
+	u.AuthSource = AuthSourceLocal
+	u.Password = "" // Clear password from struct
+	return invitationID, nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// UpsertLDAPUser creates or refreshes the local shadow record of a directory user
+// after a successful LDAP login. Full name and email are copied from the directory
+// (the email is skipped when another user already has it) and the role is only
+// overwritten when syncRole is set. PasswordHash is stored for new records only
+// and must be a hash the user cannot log in with; callers that know the record
+// exists may pass "", which no password matches either. It fails when the username
+// belongs to a user that is not managed by LDAP.
+func UpsertLDAPUser(ctx context.Context, u *User, passwordHash string, syncRole bool) error {
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+
+	query := `
+	DECLARE @email_free BIT = CASE WHEN @email IS NULL OR EXISTS (
+		SELECT 1 FROM users WHERE email = @email AND username <> @username) THEN 0 ELSE 1 END;
+
+	IF EXISTS (SELECT 1 FROM users WHERE username = @username)
+		UPDATE users SET
+			full_name = @fullname,
+			email = CASE WHEN @email_free = 1 THEN @email ELSE email END,
+			email_verified_at = CASE WHEN @email_free = 1 THEN ISNULL(email_verified_at, SYSUTCDATETIME()) ELSE email_verified_at END,
+			role = CASE WHEN @syncrole = 1 THEN @role ELSE role END
+		WHERE username = @username AND auth_source = @source
+	ELSE
+		INSERT INTO users (username, password, full_name, email, email_verified_at, role, auth_source)
+		VALUES (@username, @password, @fullname,
+			CASE WHEN @email_free = 1 THEN @email END,
+			CASE WHEN @email_free = 1 THEN SYSUTCDATETIME() END,
+			@role, @source);
+
+	SELECT ` + userColumns + ` FROM users WHERE username = @username`
+
+	row := db.QueryRowContext(ctx, query,
+		sql.Named("username", u.Username),
+		sql.Named("password", passwordHash),
+		sql.Named("fullname", u.FullName),
+		sql.Named("email", nullString(u.Email)),
+		sql.Named("role", u.Role),
+		sql.Named("syncrole", syncRole),
+		sql.Named("source", AuthSourceLDAP))
+
+	err := scanUser(row, u)
+	if err != nil {
+		return userDBError("error saving ldap user", err)
+	}
+	if u.AuthSource != AuthSourceLDAP {
+		return fmt.Errorf("username %q belongs to a %s account: %w", u.Username, u.AuthSource, ErrUsernameTaken)
+	}
+
+	return nil
+}
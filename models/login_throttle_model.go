@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LoginLockout represents a username or client IP that is temporarily locked out
+type LoginLockout struct {
+	Key         string    `json:"key" example:"user:johndoe"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LoginLockRemaining returns how long the longest active lockout among keys still applies.
+// It returns zero when none of the keys are locked.
+func LoginLockRemaining(ctx context.Context, keys ...string) (time.Duration, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	args := make([]interface{}, len(keys))
+	params := make([]string, len(keys))
+	for i, key := range keys {
+		name := fmt.Sprintf("key%d", i)
+		params[i] = "@" + name
+		args[i] = sql.Named(name, key)
+	}
+
+	query := `SELECT ISNULL(MAX(DATEDIFF(SECOND, SYSUTCDATETIME(), locked_until)), 0)
+		FROM login_throttles
+		WHERE locked_until > SYSUTCDATETIME() AND throttle_key IN (` + strings.Join(params, ", ") + `)`
+
+	var seconds int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&seconds)
+	if err != nil {
+		return 0, dbError("error querying login lockout", err)
+	}
+
+	if seconds <= 0 {
+		return 0, nil
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// RecordLoginFailure counts a failed login for key. Failures older than window are
+// forgotten. Once maxFailures is reached the key is locked for the lockout duration
+// and locked is true. It returns the number of recent failures.
+func RecordLoginFailure(ctx context.Context, key string, maxFailures int, window time.Duration, lockout time.Duration) (failures int, locked bool, err error) {
+	query := `
+	MERGE login_throttles WITH (HOLDLOCK) AS t
+	USING (SELECT @key AS throttle_key) AS s ON t.throttle_key = s.throttle_key
+	WHEN MATCHED THEN UPDATE SET
+		failures = CASE WHEN t.last_failure_at < DATEADD(SECOND, -@window, SYSUTCDATETIME()) THEN 1 ELSE t.failures + 1 END,
+		last_failure_at = SYSUTCDATETIME()
+	WHEN NOT MATCHED THEN INSERT (throttle_key, failures) VALUES (@key, 1)
+	OUTPUT INSERTED.failures;`
+
+	err = db.QueryRowContext(ctx, query,
+		sql.Named("key", key),
+		sql.Named("window", int(window.Seconds()))).Scan(&failures)
+	if err != nil {
+		return 0, false, dbError("error recording login failure", err)
+	}
+
+	if failures < maxFailures {
+		return failures, false, nil
+	}
+
+	// Threshold reached: lock the key and start counting again after the lockout
+	query = `UPDATE login_throttles
+		SET failures = 0, locked_until = DATEADD(SECOND, @lockout, SYSUTCDATETIME())
+		WHERE throttle_key = @key`
+	_, err = db.ExecContext(ctx, query,
+		sql.Named("key", key),
+		sql.Named("lockout", int(lockout.Seconds())))
+	if err != nil {
+		return failures, false, dbError("error locking login", err)
+	}
+
+	return failures, true, nil
+}
+
+// ClearLoginFailures removes the failure counter and any lockout for key.
+// It returns false when there was nothing to clear.
+func ClearLoginFailures(ctx context.Context, key string) (bool, error) {
+	query := "DELETE FROM login_throttles WHERE throttle_key = @key"
+	result, err := db.ExecContext(ctx, query, sql.Named("key", key))
+	if err != nil {
+		return false, dbError("error clearing login failures", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, dbError("error getting rows affected", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// GetActiveLoginLockouts retrieves all keys that are currently locked out
+func GetActiveLoginLockouts(ctx context.Context) ([]LoginLockout, error) {
+	query := `SELECT throttle_key, locked_until FROM login_throttles
+		WHERE locked_until > SYSUTCDATETIME() ORDER BY locked_until DESC`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, dbError("error querying login lockouts", err)
+	}
+	defer rows.Close()
+
+	var lockouts []LoginLockout
+	for rows.Next() {
+		var lockout LoginLockout
+		err := rows.Scan(&lockout.Key, &lockout.LockedUntil)
+		if err != nil {
+			return nil, dbError("error scanning login lockout", err)
+		}
+		lockouts = append(lockouts, lockout)
+	}
+
+	return lockouts, nil
+}
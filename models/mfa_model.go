@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// MFAState holds a user's TOTP enrollment data
+type MFAState struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// GetMFAState retrieves the TOTP enrollment data for a user
+func GetMFAState(ctx context.Context, userID int) (*MFAState, error) {
+	query := "SELECT mfa_secret, mfa_enabled, mfa_last_step FROM users WHERE id = @id"
+	row := db.QueryRowContext(ctx, query, sql.Named("id", userID))
+
+	var state MFAState
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err := row.Scan(&secret, &state.Enabled, &lastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user %w", ErrNotFound)
+		}
+		return nil, dbError("error querying mfa state", err)
+	}
+
+	state.Secret = secret.String
+	state.LastStep = lastStep.Int64
+	return &state, nil
+}
+
+// SetPendingMFASecret stores a new TOTP secret that is not active until confirmed
+func SetPendingMFASecret(ctx context.Context, userID int, secret string) error {
+	query := "UPDATE users SET mfa_secret = @secret, mfa_enabled = 0, mfa_last_step = NULL WHERE id = @id"
+	_, err := db.ExecContext(ctx, query, sql.Named("secret", secret), sql.Named("id", userID))
+	if err != nil {
+		return dbError("error storing mfa secret", err)
+	}
+
+	return nil
+}
+
+// EnableMFA activates the pending TOTP secret for a user
+func EnableMFA(ctx context.Context, userID int) error {
+	query := "UPDATE users SET mfa_enabled = 1 WHERE id = @id AND mfa_secret IS NOT NULL"
+	_, err := db.ExecContext(ctx, query, sql.Named("id", userID))
+	if err != nil {
+		return dbError("error enabling mfa", err)
+	}
+
+	return nil
+}
+
+// DisableMFA turns off TOTP for a user and removes the secret
+func DisableMFA(ctx context.Context, userID int) error {
+	query := "UPDATE users SET mfa_secret = NULL, mfa_enabled = 0, mfa_last_step = NULL WHERE id = @id"
+	_, err := db.ExecContext(ctx, query, sql.Named("id", userID))
+	if err != nil {
+		return dbError("error disabling mfa", err)
+	}
+
+	return nil
+}
+
+// ConsumeMFAStep records a used TOTP time step. It returns false when the step
+// (or a later one) was already used, so a code can never be accepted twice.
+func ConsumeMFAStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `UPDATE users SET mfa_last_step = @step
+		WHERE id = @id AND (mfa_last_step IS NULL OR mfa_last_step < @step)`
+	result, err := db.ExecContext(ctx, query, sql.Named("step", step), sql.Named("id", userID))
+	if err != nil {
+		return false, dbError("error recording mfa code usage", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, dbError("error getting rows affected", err)
+	}
+
+	return rowsAffected == 1, nil
+}
@@ -0,0 +1,325 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migration represents a single schema change applied once, in order
+type migration struct {
+	Version     int
+	Description string
+	Query       string
+}
+
+// migrations lists every schema change after the initial users table.
+// Append new entries at the end; never edit or reorder applied ones.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "add role to users",
+		Query: `
+		IF COL_LENGTH('users', 'role') IS NULL
+		ALTER TABLE users ADD role NVARCHAR(20) NOT NULL
+			CONSTRAINT DF_users_role DEFAULT 'user'`,
+	},
+	{
+		Version:     2,
+		Description: "create api_keys table",
+		Query: `
+		CREATE TABLE api_keys (
+			id INT IDENTITY(1,1) PRIMARY KEY,
+			name NVARCHAR(100) NOT NULL,
+			key_prefix NVARCHAR(20) NOT NULL,
+			key_hash CHAR(64) UNIQUE NOT NULL,
+			scopes NVARCHAR(500) NOT NULL,
+			created_by INT NULL REFERENCES users(id) ON DELETE SET NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			expires_at DATETIME2 NULL,
+			last_used_at DATETIME2 NULL,
+			revoked_at DATETIME2 NULL
+		)`,
+	},
+	{
+		Version:     3,
+		Description: "add totp mfa columns to users",
+		Query: `
+		ALTER TABLE users ADD
+			mfa_secret NVARCHAR(64) NULL,
+			mfa_enabled BIT NOT NULL CONSTRAINT DF_users_mfa_enabled DEFAULT 0,
+			mfa_last_step BIGINT NULL`,
+	},
+	{
+		Version:     4,
+		Description: "create audit_logs table",
+		Query: `
+		CREATE TABLE audit_logs (
+			id INT IDENTITY(1,1) PRIMARY KEY,
+			event NVARCHAR(50) NOT NULL,
+			actor_id INT NULL,
+			actor NVARCHAR(100) NULL,
+			target NVARCHAR(200) NULL,
+			ip NVARCHAR(64) NULL,
+			details NVARCHAR(1000) NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+		)`,
+	},
+	{
+		Version:     5,
+		Description: "create login_throttles table",
+		Query: `
+		CREATE TABLE login_throttles (
+			throttle_key NVARCHAR(200) PRIMARY KEY,
+			failures INT NOT NULL DEFAULT 0,
+			last_failure_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			locked_until DATETIME2 NULL
+		)`,
+	},
+	{
+		Version:     6,
+		Description: "add email to users",
+		Query:       `ALTER TABLE users ADD email NVARCHAR(254) NULL`,
+	},
+	{
+		Version:     7,
+		Description: "add unique index on users email",
+		Query:       `CREATE UNIQUE INDEX UX_users_email ON users (email) WHERE email IS NOT NULL`,
+	},
+	{
+		Version:     8,
+		Description: "create password_reset_tokens table",
+		Query: `
+		CREATE TABLE password_reset_tokens (
+			id INT IDENTITY(1,1) PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash CHAR(64) UNIQUE NOT NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			expires_at DATETIME2 NOT NULL,
+			used_at DATETIME2 NULL
+		)`,
+	},
+	{
+		Version:     9,
+		Description: "add email verification columns to users",
+		Query: `
+		ALTER TABLE users ADD
+			email_verified_at DATETIME2 NULL,
+			verification_sent_at DATETIME2 NULL`,
+	},
+	{
+		Version:     10,
+		Description: "create sessions table",
+		Query: `
+		CREATE TABLE sessions (
+			id NVARCHAR(64) PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent NVARCHAR(512) NULL,
+			ip NVARCHAR(64) NULL,
+			device_label NVARCHAR(100) NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			last_seen_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			expires_at DATETIME2 NOT NULL,
+			revoked_at DATETIME2 NULL
+		)`,
+	},
+	{
+		Version:     11,
+		Description: "create oauth_clients table",
+		Query: `
+		CREATE TABLE oauth_clients (
+			id INT IDENTITY(1,1) PRIMARY KEY,
+			client_id NVARCHAR(64) UNIQUE NOT NULL,
+			secret_hash CHAR(64) NULL,
+			name NVARCHAR(100) NOT NULL,
+			redirect_uris NVARCHAR(2000) NOT NULL,
+			grant_types NVARCHAR(200) NOT NULL,
+			scopes NVARCHAR(500) NOT NULL,
+			created_by INT NULL REFERENCES users(id) ON DELETE SET NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			revoked_at DATETIME2 NULL
+		)`,
+	},
+	{
+		Version:     12,
+		Description: "create oauth_codes table",
+		Query: `
+		CREATE TABLE oauth_codes (
+			code_hash CHAR(64) PRIMARY KEY,
+			client_id NVARCHAR(64) NOT NULL,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			redirect_uri NVARCHAR(500) NOT NULL,
+			scopes NVARCHAR(500) NOT NULL,
+			code_challenge NVARCHAR(128) NOT NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			expires_at DATETIME2 NOT NULL,
+			used_at DATETIME2 NULL
+		)`,
+	},
+	{
+		Version:     13,
+		Description: "create oidc_login_states table",
+		Query: `
+		CREATE TABLE oidc_login_states (
+			state_hash CHAR(64) PRIMARY KEY,
+			nonce NVARCHAR(64) NOT NULL,
+			code_verifier NVARCHAR(128) NOT NULL,
+			expires_at DATETIME2 NOT NULL
+		)`,
+	},
+	{
+		Version:     14,
+		Description: "create user_identities table",
+		Query: `
+		CREATE TABLE user_identities (
+			id INT IDENTITY(1,1) PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider NVARCHAR(300) NOT NULL,
+			subject NVARCHAR(255) NOT NULL,
+			email NVARCHAR(254) NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			last_login_at DATETIME2 NULL,
+			CONSTRAINT UX_user_identities_provider_subject UNIQUE (provider, subject)
+		)`,
+	},
+	{
+		Version:     15,
+		Description: "add auth_source to users",
+		Query: `
+		ALTER TABLE users ADD auth_source NVARCHAR(20) NOT NULL
+			CONSTRAINT DF_users_auth_source DEFAULT 'local'`,
+	},
+	{
+		Version:     16,
+		Description: "add password_breached_at to users",
+		Query: `
+		ALTER TABLE users ADD password_breached_at DATETIME2 NULL`,
+	},
+	{
+		Version:     17,
+		Description: "create invitations table",
+		Query: `
+		CREATE TABLE invitations (
+			id INT IDENTITY(1,1) PRIMARY KEY,
+			code_prefix NVARCHAR(16) NOT NULL,
+			code_hash CHAR(64) UNIQUE NOT NULL,
+			role NVARCHAR(20) NOT NULL,
+			note NVARCHAR(200) NULL,
+			max_uses INT NOT NULL,
+			use_count INT NOT NULL DEFAULT 0,
+			created_by INT NULL REFERENCES users(id) ON DELETE SET NULL,
+			created_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME(),
+			expires_at DATETIME2 NULL,
+			revoked_at DATETIME2 NULL
+		)`,
+	},
+	{
+		Version:     18,
+		Description: "create invitation_redemptions table",
+		Query: `
+		CREATE TABLE invitation_redemptions (
+			id INT IDENTITY(1,1) PRIMARY KEY,
+			invitation_id INT NOT NULL REFERENCES invitations(id),
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			redeemed_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+		)`,
+	},
+	{
+		Version:     19,
+		Description: "create rate_limit_buckets table",
+		Query: `
+		CREATE TABLE rate_limit_buckets (
+			bucket_key NVARCHAR(200) PRIMARY KEY,
+			tokens FLOAT NOT NULL,
+			updated_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+		)`,
+	},
+	{
+		Version:     20,
+		Description: "allow one identity per provider for each user",
+		Query: `
+		DELETE i FROM user_identities i
+		WHERE EXISTS (
+			SELECT 1 FROM user_identities first
+			WHERE first.user_id = i.user_id AND first.provider = i.provider AND first.id < i.id
+		);
+		ALTER TABLE user_identities ADD
+			CONSTRAINT UX_user_identities_user_provider UNIQUE (user_id, provider)`,
+	},
+}
+
+// runMigrations applies all pending migrations and records them in schema_migrations
+func runMigrations() error {
+	createTableQuery := `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='schema_migrations' AND xtype='U')
+	CREATE TABLE schema_migrations (
+		version INT PRIMARY KEY,
+		description NVARCHAR(200) NOT NULL,
+		applied_at DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+	)`
+
+	_, err := db.Exec(createTableQuery)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+
+	for _, m := range migrations {
+		var applied int
+		err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = @version",
+			sql.Named("version", m.Version)).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("error checking migration %d: %v", m.Version, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		err = applyMigration(m)
+		if err != nil {
+			return err
+		}
+		slog.Info("Applied migration", "version", m.Version, "description", m.Description)
+	}
+
+	return nil
+}
+
+// MigrationStatus returns the highest applied migration version and the latest
+// version this build knows about
+func MigrationStatus(ctx context.Context) (applied int, latest int, err error) {
+	latest = migrations[len(migrations)-1].Version
+	if db == nil {
+		return 0, latest, fmt.Errorf("database is not initialized")
+	}
+
+	var version sql.NullInt64
+	err = db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, latest, fmt.Errorf("error reading migration status: %v", err)
+	}
+	return int(version.Int64), latest, nil
+}
+
+// applyMigration runs a migration and records it inside one transaction
+func applyMigration(m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting migration %d: %v", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(m.Query)
+	if err != nil {
+		return fmt.Errorf("error applying migration %d: %v", m.Version, err)
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, description) VALUES (@version, @description)",
+		sql.Named("version", m.Version),
+		sql.Named("description", m.Description))
+	if err != nil {
+		return fmt.Errorf("error recording migration %d: %v", m.Version, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OAuth 2.0 grant types supported by the authorization server
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthClient represents an application registered to obtain tokens through OAuth 2.0
+type OAuthClient struct {
+	ID           int        `json:"id" example:"1"`
+	ClientID     string     `json:"client_id" example:"Yk2v9QmW4xT7bN1cR8pL3a"`
+	SecretHash   string     `json:"-"`
+	Name         string     `json:"name" example:"Intranet portal"`
+	RedirectURIs []string   `json:"redirect_uris" example:"https://intranet.example.com/callback"`
+	GrantTypes   []string   `json:"grant_types" example:"authorization_code"`
+	Scopes       []string   `json:"scopes" example:"users:read"`
+	CreatedBy    int        `json:"created_by" example:"1"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// oauthClientColumns is the column list read by scanOAuthClient
+const oauthClientColumns = "id, client_id, ISNULL(secret_hash, ''), name, redirect_uris, grant_types, scopes, ISNULL(created_by, 0), created_at, revoked_at"
+
+// IsValidGrantType reports whether grant is a supported grant type
+func IsValidGrantType(grant string) bool {
+	return grant == GrantAuthorizationCode || grant == GrantClientCredentials
+}
+
+// IsActive reports whether the client has not been revoked
+func (cl *OAuthClient) IsActive() bool {
+	return cl.RevokedAt == nil
+}
+
+// IsConfidential reports whether the client authenticates with a secret
+func (cl *OAuthClient) IsConfidential() bool {
+	return cl.SecretHash != ""
+}
+
+// AllowsGrant reports whether the client is registered for a grant type
+func (cl *OAuthClient) AllowsGrant(grant string) bool {
+	return containsString(cl.GrantTypes, grant)
+}
+
+// AllowsRedirectURI reports whether uri exactly matches a registered redirect URI
+func (cl *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return containsString(cl.RedirectURIs, uri)
+}
+
+// AllowsScopes reports whether every scope is registered for the client
+func (cl *OAuthClient) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !containsString(cl.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Create stores a new OAuth client. ClientID and, for confidential clients,
+// SecretHash must already be set by the caller.
+func (cl *OAuthClient) Create(ctx context.Context) error {
+	query := `INSERT INTO oauth_clients (client_id, secret_hash, name, redirect_uris, grant_types, scopes, created_by)
+		OUTPUT INSERTED.id, INSERTED.created_at
+		VALUES (@clientid, @secrethash, @name, @redirecturis, @granttypes, @scopes, @createdby)`
+
+	err := db.QueryRowContext(ctx, query,
+		sql.Named("clientid", cl.ClientID),
+		sql.Named("secrethash", nullString(cl.SecretHash)),
+		sql.Named("name", cl.Name),
+		sql.Named("redirecturis", strings.Join(cl.RedirectURIs, " ")),
+		sql.Named("granttypes", strings.Join(cl.GrantTypes, " ")),
+		sql.Named("scopes", strings.Join(cl.Scopes, " ")),
+		sql.Named("createdby", cl.CreatedBy)).Scan(&cl.ID, &cl.CreatedAt)
+	if err != nil {
+		return dbError("error creating oauth client", err)
+	}
+
+	return nil
+}
+
+// GetAllOAuthClients retrieves all OAuth clients, including revoked ones
+func GetAllOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	query := "SELECT " + oauthClientColumns + " FROM oauth_clients ORDER BY id"
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, dbError("error querying oauth clients", err)
+	}
+	defer rows.Close()
+
+	var clients []OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+
+	return clients, nil
+}
+
+// GetOAuthClientByClientID retrieves an OAuth client by its public client_id
+func GetOAuthClientByClientID(ctx context.Context, clientID string) (*OAuthClient, error) {
+	query := "SELECT " + oauthClientColumns + " FROM oauth_clients WHERE client_id = @clientid"
+	row := db.QueryRowContext(ctx, query, sql.Named("clientid", clientID))
+
+	client, err := scanOAuthClient(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("oauth client %w", ErrNotFound)
+		}
+		return nil, dbError("error querying oauth client", err)
+	}
+
+	return client, nil
+}
+
+// RevokeOAuthClient marks an OAuth client as revoked so it can no longer obtain tokens
+func RevokeOAuthClient(ctx context.Context, id int) error {
+	query := "UPDATE oauth_clients SET revoked_at = SYSUTCDATETIME() WHERE id = @id AND revoked_at IS NULL"
+	result, err := db.ExecContext(ctx, query, sql.Named("id", id))
+	if err != nil {
+		return dbError("error revoking oauth client", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return dbError("error getting rows affected", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("oauth client %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// scanOAuthClient reads an oauth_clients row selected with oauthClientColumns
+func scanOAuthClient(row rowScanner) (*OAuthClient, error) {
+	var client OAuthClient
+	var redirectURIs, grantTypes, scopes string
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&client.ID, &client.ClientID, &client.SecretHash, &client.Name,
+		&redirectURIs, &grantTypes, &scopes, &client.CreatedBy, &client.CreatedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, dbError("error scanning oauth client", err)
+	}
+
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.GrantTypes = strings.Fields(grantTypes)
+	client.Scopes = strings.Fields(scopes)
+	client.RevokedAt = nullTimePtr(revokedAt)
+
+	return &client, nil
+}
+
+// OAuthCode is a single-use authorization code issued by /oauth/authorize
+type OAuthCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        int
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string // PKCE S256 challenge
+}
+
+// CreateOAuthCode stores an authorization code that expires after ttl
+func CreateOAuthCode(ctx context.Context, code *OAuthCode, ttl time.Duration) error {
+	query := `INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+		VALUES (@hash, @clientid, @userid, @redirecturi, @scopes, @challenge, DATEADD(SECOND, @ttl, SYSUTCDATETIME()))`
+
+	_, err := db.ExecContext(ctx, query,
+		sql.Named("hash", code.CodeHash),
+		sql.Named("clientid", code.ClientID),
+		sql.Named("userid", code.UserID),
+		sql.Named("redirecturi", code.RedirectURI),
+		sql.Named("scopes", strings.Join(code.Scopes, " ")),
+		sql.Named("challenge", code.CodeChallenge),
+		sql.Named("ttl", int(ttl.Seconds())))
+	if err != nil {
+		return dbError("error creating authorization code", err)
+	}
+
+	return nil
+}
+
+// ConsumeOAuthCode atomically marks an unused, unexpired authorization code as
+// used and returns it. A code can therefore be exchanged only once.
+func ConsumeOAuthCode(ctx context.Context, hash string) (*OAuthCode, error) {
+	query := `UPDATE oauth_codes SET used_at = SYSUTCDATETIME()
+		OUTPUT INSERTED.code_hash, INSERTED.client_id, INSERTED.user_id, INSERTED.redirect_uri, INSERTED.scopes, INSERTED.code_challenge
+		WHERE code_hash = @hash AND used_at IS NULL AND expires_at > SYSUTCDATETIME()`
+	row := db.QueryRowContext(ctx, query, sql.Named("hash", hash))
+
+	var code OAuthCode
+	var scopes string
+	err := row.Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &scopes, &code.CodeChallenge)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("authorization code %w", ErrNotFound)
+		}
+		return nil, dbError("error consuming authorization code", err)
+	}
+
+	code.Scopes = strings.Fields(scopes)
+	return &code, nil
+}
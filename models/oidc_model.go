@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserIdentity links a local user to an account at an external OpenID Connect provider
+type UserIdentity struct {
+	ID          int        `json:"id" example:"1"`
+	UserID      int        `json:"user_id" example:"1"`
+	Provider    string     `json:"provider" example:"https://idp.example.com"`
+	Subject     string     `json:"subject" example:"248289761001"`
+	Email       string     `json:"email,omitempty" example:"john@example.com"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// CreateOIDCLoginState stores the nonce and PKCE verifier of a login that was
+// just sent to the provider. Expired states are removed at the same time.
+func CreateOIDCLoginState(ctx context.Context, stateHash string, nonce string, codeVerifier string, ttl time.Duration) error {
+	query := `DELETE FROM oidc_login_states WHERE expires_at < SYSUTCDATETIME();
+		INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at)
+		VALUES (@hash, @nonce, @verifier, DATEADD(SECOND, @ttl, SYSUTCDATETIME()))`
+
+	_, err := db.ExecContext(ctx, query,
+		sql.Named("hash", stateHash),
+		sql.Named("nonce", nonce),
+		sql.Named("verifier", codeVerifier),
+		sql.Named("ttl", int(ttl.Seconds())))
+	if err != nil {
+		return dbError("error creating oidc login state", err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCLoginState atomically removes an unexpired login state and returns
+// its nonce and PKCE verifier, so each state can complete only one login
+func ConsumeOIDCLoginState(ctx context.Context, stateHash string) (string, string, error) {
+	query := `DELETE FROM oidc_login_states
+		OUTPUT DELETED.nonce, DELETED.code_verifier
+		WHERE state_hash = @hash AND expires_at > SYSUTCDATETIME()`
+
+	var nonce, verifier string
+	err := db.QueryRowContext(ctx, query, sql.Named("hash", stateHash)).Scan(&nonce, &verifier)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", fmt.Errorf("oidc login state %w", ErrNotFound)
+		}
+		return "", "", dbError("error consuming oidc login state", err)
+	}
+
+	return nonce, verifier, nil
+}
+
+// GetUserIdentity retrieves the identity for a provider and subject
+func GetUserIdentity(ctx context.Context, provider string, subject string) (*UserIdentity, error) {
+	query := `SELECT id, user_id, provider, subject, ISNULL(email, ''), created_at, last_login_at
+		FROM user_identities WHERE provider = @provider AND subject = @subject`
+	row := db.QueryRowContext(ctx, query, sql.Named("provider", provider), sql.Named("subject", subject))
+
+	var identity UserIdentity
+	var lastLoginAt sql.NullTime
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&identity.Email, &identity.CreatedAt, &lastLoginAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("identity %w", ErrNotFound)
+		}
+		return nil, dbError("error querying identity", err)
+	}
+
+	identity.LastLoginAt = nullTimePtr(lastLoginAt)
+	return &identity, nil
+}
+
+// UserHasIdentity reports whether any external identity is linked to the user
+func UserHasIdentity(ctx context.Context, userID int) (bool, error) {
+	query := "SELECT COUNT(*) FROM user_identities WHERE user_id = @userid"
+
+	var count int
+	err := db.QueryRowContext(ctx, query, sql.Named("userid", userID)).Scan(&count)
+	if err != nil {
+		return false, dbError("error querying identities", err)
+	}
+
+	return count > 0, nil
+}
+
+// Create links the identity to an existing user
+func (i *UserIdentity) Create(ctx context.Context) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		OUTPUT INSERTED.id, INSERTED.created_at
+		VALUES (@userid, @provider, @subject, @email, SYSUTCDATETIME())`
+
+	err := db.QueryRowContext(ctx, query,
+		sql.Named("userid", i.UserID),
+		sql.Named("provider", i.Provider),
+		sql.Named("subject", i.Subject),
+		sql.Named("email", nullString(i.Email))).Scan(&i.ID, &i.CreatedAt)
+	if err != nil {
+		return dbError("error creating identity", err)
+	}
+
+	return nil
+}
+
+// TouchUserIdentity records a login through an identity
+func TouchUserIdentity(ctx context.Context, id int) error {
+	query := "UPDATE user_identities SET last_login_at = SYSUTCDATETIME() WHERE id = @id"
+	_, err := db.ExecContext(ctx, query, sql.Named("id", id))
+	if err != nil {
+		return dbError("error updating identity", err)
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity provisions a new user linked to an external identity in
+// one transaction. The user's email is marked verified when emailVerified is set.
+// PasswordHash must already hold a hash the user cannot log in with.
+func CreateUserWithIdentity(ctx context.Context, user *User, passwordHash string, identity *UserIdentity, emailVerified bool) error {
+	if user.Role == "" {
+		user.Role = RoleUser
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError("error starting transaction", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO users (username, password, full_name, email, role, email_verified_at, auth_source)
+		OUTPUT INSERTED.id
+		VALUES (@username, @password, @fullname, @email, @role,
+			CASE WHEN @verified = 1 AND @email IS NOT NULL THEN SYSUTCDATETIME() END, @source)`
+	err = tx.QueryRowContext(ctx, query,
+		sql.Named("username", user.Username),
+		sql.Named("password", passwordHash),
+		sql.Named("fullname", user.FullName),
+		sql.Named("email", nullString(user.Email)),
+		sql.Named("role", user.Role),
+		sql.Named("verified", emailVerified),
+		sql.Named("source", AuthSourceOIDC)).Scan(&user.ID)
+	if err != nil {
+		return userDBError("error creating user", err)
+	}
+
+	identity.UserID = user.ID
+	query = `INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		OUTPUT INSERTED.id, INSERTED.created_at
+		VALUES (@userid, @provider, @subject, @email, SYSUTCDATETIME())`
+	err = tx.QueryRowContext(ctx, query,
+		sql.Named("userid", identity.UserID),
+		sql.Named("provider", identity.Provider),
+		sql.Named("subject", identity.Subject),
+		sql.Named("email", nullString(identity.Email))).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		return dbError("error creating identity", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("error committing transaction", err)
+	}
+
+	user.EmailVerified = emailVerified && user.Email != ""
+	user.AuthSource = AuthSourceOIDC
+	return nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreatePasswordResetToken stores the hash of a new reset token for a user and
+// invalidates any earlier tokens that were not used yet
+func CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError("error starting transaction", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE password_reset_tokens SET used_at = SYSUTCDATETIME() WHERE user_id = @userid AND used_at IS NULL",
+		sql.Named("userid", userID))
+	if err != nil {
+		return dbError("error invalidating reset tokens", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES (@userid, @hash, DATEADD(SECOND, @ttl, SYSUTCDATETIME()))`,
+		sql.Named("userid", userID),
+		sql.Named("hash", tokenHash),
+		sql.Named("ttl", int(ttl.Seconds())))
+	if err != nil {
+		return dbError("error creating reset token", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetPasswordResetTokenUser returns the user a valid (unused, unexpired) reset token belongs to
+func GetPasswordResetTokenUser(ctx context.Context, tokenHash string) (int, error) {
+	query := `SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = @hash AND used_at IS NULL AND expires_at > SYSUTCDATETIME()`
+
+	var userID int
+	err := db.QueryRowContext(ctx, query, sql.Named("hash", tokenHash)).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("reset token %w", ErrNotFound)
+		}
+		return 0, dbError("error querying reset token", err)
+	}
+
+	return userID, nil
+}
+
+// ConsumePasswordResetToken marks a valid reset token as used. It returns false
+// when the token was already used or has expired, so each token works only once.
+func ConsumePasswordResetToken(ctx context.Context, tokenHash string) (bool, error) {
+	query := `UPDATE password_reset_tokens SET used_at = SYSUTCDATETIME()
+		WHERE token_hash = @hash AND used_at IS NULL AND expires_at > SYSUTCDATETIME()`
+	result, err := db.ExecContext(ctx, query, sql.Named("hash", tokenHash))
+	if err != nil {
+		return false, dbError("error consuming reset token", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, dbError("error getting rows affected", err)
+	}
+
+	return rowsAffected == 1, nil
+}
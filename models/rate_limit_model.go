@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"simple-restful-api/utils"
+	"sync"
+	"time"
+)
+
+// rateLimitIdleTTL is how long an untouched bucket is kept. It must be longer
+// than the longest configured rate limit period.
+const rateLimitIdleTTL = 24 * time.Hour
+
+// DBRateLimitStore keeps rate limit buckets in the database so that every
+// instance of the API enforces the same limits
+type DBRateLimitStore struct {
+	mu         sync.Mutex
+	lastPurged time.Time
+}
+
+// NewDBRateLimitStore creates a database-backed rate limit store
+func NewDBRateLimitStore() *DBRateLimitStore {
+	return &DBRateLimitStore{lastPurged: time.Now()}
+}
+
+// Take takes one request from the bucket for key. The row is locked for the
+// duration of the transaction so concurrent requests cannot spend the same token.
+func (s *DBRateLimitStore) Take(ctx context.Context, key string, limit utils.RateLimit) (utils.RateLimitResult, error) {
+	s.purgeIdle(ctx)
+
+	result, err := s.take(ctx, key, limit)
+	// Two requests can both find a new key missing; the one that loses the
+	// insert retries and then finds the other's row
+	if errors.Is(err, ErrConflict) {
+		result, err = s.take(ctx, key, limit)
+	}
+	return result, err
+}
+
+// take reads, refills and writes back the bucket for key in one transaction
+func (s *DBRateLimitStore) take(ctx context.Context, key string, limit utils.RateLimit) (utils.RateLimitResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return utils.RateLimitResult{}, dbError("error starting transaction", err)
+	}
+	defer tx.Rollback()
+
+	// Elapsed time is measured by the database clock, which all instances share
+	var tokens float64
+	var elapsedMs int64
+	query := `SELECT tokens, DATEDIFF_BIG(MILLISECOND, updated_at, SYSUTCDATETIME())
+		FROM rate_limit_buckets WITH (UPDLOCK, HOLDLOCK) WHERE bucket_key = @key`
+	err = tx.QueryRowContext(ctx, query, sql.Named("key", key)).Scan(&tokens, &elapsedMs)
+	exists := err == nil
+	if err == sql.ErrNoRows {
+		tokens = float64(limit.Limit)
+	} else if err != nil {
+		return utils.RateLimitResult{}, dbError("error querying rate limit bucket", err)
+	}
+
+	tokens, result := limit.Consume(tokens, time.Duration(elapsedMs)*time.Millisecond)
+
+	if exists {
+		query = "UPDATE rate_limit_buckets SET tokens = @tokens, updated_at = SYSUTCDATETIME() WHERE bucket_key = @key"
+	} else {
+		query = "INSERT INTO rate_limit_buckets (bucket_key, tokens) VALUES (@key, @tokens)"
+	}
+	_, err = tx.ExecContext(ctx, query, sql.Named("key", key), sql.Named("tokens", tokens))
+	if err != nil {
+		return utils.RateLimitResult{}, dbError("error saving rate limit bucket", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return utils.RateLimitResult{}, dbError("error committing rate limit bucket", err)
+	}
+
+	return result, nil
+}
+
+// purgeIdle deletes buckets nobody has used for rateLimitIdleTTL, at most once
+// every ten minutes per instance, in the background
+func (s *DBRateLimitStore) purgeIdle(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastPurged) < 10*time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPurged = time.Now()
+	s.mu.Unlock()
+
+	utils.RunInBackground(ctx, func(ctx context.Context) {
+		query := "DELETE FROM rate_limit_buckets WHERE updated_at < DATEADD(SECOND, -@ttl, SYSUTCDATETIME())"
+		_, err := db.ExecContext(ctx, query, sql.Named("ttl", int(rateLimitIdleTTL.Seconds())))
+		if err != nil {
+			utils.Logger(ctx).Error("Error purging rate limit buckets", "error", err)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Session represents a login on a specific device, tied to the tokens issued for it
+type Session struct {
+	ID          string     `json:"id" example:"m3Jq8xZ1cV7bN2kL5pR9tA"`
+	UserID      int        `json:"user_id" example:"1"`
+	UserAgent   string     `json:"user_agent" example:"Mozilla/5.0 (Windows NT 10.0; Win64; x64) ..."`
+	IP          string     `json:"ip" example:"192.0.2.10"`
+	DeviceLabel string     `json:"device_label" example:"Chrome on Windows"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// sessionColumns is the column list read by scanSession
+const sessionColumns = "id, user_id, ISNULL(user_agent, ''), ISNULL(ip, ''), ISNULL(device_label, ''), created_at, last_seen_at, expires_at, revoked_at"
+
+// IsActive reports whether the session is neither revoked nor expired
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().UTC().Before(s.ExpiresAt)
+}
+
+// Create stores a new session. ID must already be set by the caller.
+func (s *Session) Create(ctx context.Context, ttl time.Duration) error {
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip, device_label, expires_at)
+		OUTPUT INSERTED.created_at, INSERTED.last_seen_at, INSERTED.expires_at
+		VALUES (@id, @userid, @useragent, @ip, @label, DATEADD(SECOND, @ttl, SYSUTCDATETIME()))`
+
+	err := db.QueryRowContext(ctx, query,
+		sql.Named("id", s.ID),
+		sql.Named("userid", s.UserID),
+		sql.Named("useragent", nullString(truncate(s.UserAgent, 512))),
+		sql.Named("ip", nullString(s.IP)),
+		sql.Named("label", nullString(truncate(s.DeviceLabel, 100))),
+		sql.Named("ttl", int(ttl.Seconds()))).Scan(&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err != nil {
+		return dbError("error creating session", err)
+	}
+
+	return nil
+}
+
+// GetSessionByID retrieves a session by ID
+func GetSessionByID(ctx context.Context, id string) (*Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE id = @id"
+	row := db.QueryRowContext(ctx, query, sql.Named("id", id))
+
+	session, err := scanSession(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("session %w", ErrNotFound)
+		}
+		return nil, dbError("error querying session", err)
+	}
+
+	return session, nil
+}
+
+// GetActiveSessionsByUser retrieves the sessions of a user that are neither revoked nor expired
+func GetActiveSessionsByUser(ctx context.Context, userID int) ([]Session, error) {
+	query := "SELECT " + sessionColumns + ` FROM sessions
+		WHERE user_id = @userid AND revoked_at IS NULL AND expires_at > SYSUTCDATETIME()
+		ORDER BY last_seen_at DESC`
+	rows, err := db.QueryContext(ctx, query, sql.Named("userid", userID))
+	if err != nil {
+		return nil, dbError("error querying sessions", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession updates the last-seen time of a session, at most once per interval
+func TouchSession(ctx context.Context, id string, interval time.Duration) error {
+	query := `UPDATE sessions SET last_seen_at = SYSUTCDATETIME()
+		WHERE id = @id AND last_seen_at < DATEADD(SECOND, -@interval, SYSUTCDATETIME())`
+	_, err := db.ExecContext(ctx, query, sql.Named("id", id), sql.Named("interval", int(interval.Seconds())))
+	if err != nil {
+		return dbError("error updating session", err)
+	}
+
+	return nil
+}
+
+// RevokeSession revokes an active session. When userID is not zero the session
+// must belong to that user. It returns an error when no matching session exists.
+func RevokeSession(ctx context.Context, id string, userID int) error {
+	query := `UPDATE sessions SET revoked_at = SYSUTCDATETIME()
+		WHERE id = @id AND revoked_at IS NULL AND (@userid = 0 OR user_id = @userid)`
+	result, err := db.ExecContext(ctx, query, sql.Named("id", id), sql.Named("userid", userID))
+	if err != nil {
+		return dbError("error revoking session", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return dbError("error getting rows affected", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("session %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of a user
+func RevokeUserSessions(ctx context.Context, userID int) error {
+	query := "UPDATE sessions SET revoked_at = SYSUTCDATETIME() WHERE user_id = @userid AND revoked_at IS NULL"
+	_, err := db.ExecContext(ctx, query, sql.Named("userid", userID))
+	if err != nil {
+		return dbError("error revoking sessions", err)
+	}
+
+	return nil
+}
+
+// scanSession reads a sessions row selected with sessionColumns
+func scanSession(row rowScanner) (*Session, error) {
+	var session Session
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.DeviceLabel,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, dbError("error scanning session", err)
+	}
+
+	session.RevokedAt = nullTimePtr(revokedAt)
+	return &session, nil
+}
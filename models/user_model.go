@@ -1,22 +1,64 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"simple-restful-api/utils"
+	"sync"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/denisenkom/go-mssqldb"
 	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
 // User represents a user in the system
 type User struct {
-	ID       int    `json:"id" example:"1"`
-	Username string `json:"username" example:"johndoe"`
-	Password string `json:"password,omitempty"` // omitempty เพื่อไม่ส่ง password ใน response
-	FullName string `json:"full_name" example:"John Doe"`
+	ID               int    `json:"id" example:"1"`
+	Username         string `json:"username" example:"johndoe"`
+	Password         string `json:"password,omitempty"` // omitempty เพื่อไม่ส่ง password ใน response
+	FullName         string `json:"full_name" example:"John Doe"`
+	Email            string `json:"email,omitempty" example:"john@example.com"`
+	EmailVerified    bool   `json:"email_verified" example:"false"`
+	Role             string `json:"role" example:"user"`
+	MFAEnabled       bool   `json:"mfa_enabled" example:"false"`
+	AuthSource       string `json:"auth_source" example:"local"`       // where the password is checked
+	PasswordBreached bool   `json:"password_breached" example:"false"` // found in a data breach after it was set
+}
+
+// userColumns is the column list read by scanUser (password is selected separately)
+const userColumns = "id, username, full_name, ISNULL(email, ''), " +
+	"CAST(CASE WHEN email_verified_at IS NULL THEN 0 ELSE 1 END AS BIT), role, mfa_enabled, auth_source, " +
+	"CAST(CASE WHEN password_breached_at IS NULL THEN 0 ELSE 1 END AS BIT)"
+
+// scanUser reads a users row selected with userColumns, followed by any extra destinations
+func scanUser(row rowScanner, user *User, extra ...interface{}) error {
+	dest := []interface{}{&user.ID, &user.Username, &user.FullName, &user.Email, &user.EmailVerified, &user.Role, &user.MFAEnabled, &user.AuthSource, &user.PasswordBreached}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+
+	// RoleService is assigned to non-user credentials such as API keys
+	RoleService = "service"
+)
+
+// Authentication sources, recorded per user
+const (
+	AuthSourceLocal = "local" // password stored in this database
+	AuthSourceLDAP  = "ldap"  // shadow user whose password is checked by the directory
+	AuthSourceOIDC  = "oidc"  // provisioned at first login through OpenID Connect
+)
+
+// IsValidRole reports whether role is one of the known user roles
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
 }
 
 var db *sql.DB
@@ -26,7 +68,7 @@ func InitDB() error {
 	// Load environment variables from .env file
 	err := godotenv.Load()
 	if err != nil {
-		log.Println("Warning: Error loading .env file, using system environment variables")
+		slog.Warn("Error loading .env file, using system environment variables")
 	}
 
 	// Get database configuration from environment variables
@@ -57,7 +99,11 @@ func InitDB() error {
 	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%s;database=%s",
 		dbServer, dbUser, dbPassword, dbPort, dbName)
 
-	db, err = sql.Open("sqlserver", connString)
+	// Every query, exec and transaction gets a span under the caller's context.
+	// Queries use parameters, so the recorded statements contain no user data.
+	db, err = otelsql.Open("sqlserver", connString,
+		otelsql.WithAttributes(semconv.DBSystemMSSQL, semconv.DBName(dbName)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}))
 	if err != nil {
 		return fmt.Errorf("error opening database: %v", err)
 	}
@@ -83,10 +129,31 @@ func InitDB() error {
 		return fmt.Errorf("error creating table: %v", err)
 	}
 
-	log.Println("Database connected successfully")
+	err = runMigrations()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Database connected successfully")
 	return nil
 }
 
+// PingDB checks that the database is reachable
+func PingDB(ctx context.Context) error {
+	if db == nil {
+		return fmt.Errorf("database is not initialized: %w", ErrUnavailable)
+	}
+	return db.PingContext(ctx)
+}
+
+// DBStats returns connection pool statistics, or zero values before InitDB
+func DBStats() sql.DBStats {
+	if db == nil {
+		return sql.DBStats{}
+	}
+	return db.Stats()
+}
+
 // CloseDB closes the database connection
 func CloseDB() {
 	if db != nil {
@@ -95,43 +162,50 @@ func CloseDB() {
 }
 
 // Create creates a new user
-func (u *User) Create() error {
-	// Hash password with bcrypt
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+func (u *User) Create(ctx context.Context) error {
+	// Hash password with the configured password hasher
+	hashedPassword, err := utils.HashPassword(ctx, u.Password)
 	if err != nil {
 		return fmt.Errorf("error hashing password: %v", err)
 	}
 
-	query := "INSERT INTO users (username, password, full_name) OUTPUT INSERTED.id VALUES (@username, @password, @fullname)"
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+
+	query := "INSERT INTO users (username, password, full_name, email, role) OUTPUT INSERTED.id VALUES (@username, @password, @fullname, @email, @role)"
 	var newID int
-	err = db.QueryRow(query,
+	err = db.QueryRowContext(ctx, query,
 		sql.Named("username", u.Username),
-		sql.Named("password", string(hashedPassword)),
-		sql.Named("fullname", u.FullName)).Scan(&newID)
+		sql.Named("password", hashedPassword),
+		sql.Named("fullname", u.FullName),
+		sql.Named("email", nullString(u.Email)),
+		sql.Named("role", u.Role)).Scan(&newID)
 	if err != nil {
-		return fmt.Errorf("error creating user: %v", err)
+		return userDBError("error creating user", err)
 	}
 
 	u.ID = newID
+	u.AuthSource = AuthSourceLocal
 	u.Password = "" // Clear password from struct
 	return nil
 }
 
 // GetAll retrieves all users
-func GetAllUsers() ([]User, error) {
-	query := "SELECT id, username, full_name FROM users"
-	rows, err := db.Query(query)
+func GetAllUsers(ctx context.Context) ([]User, error) {
+	query := "SELECT " + userColumns + " FROM users"
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("error querying users: %v", err)
+		return nil, dbError("error querying users", err)
 	}
 	defer rows.Close()
 
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.FullName)
+		err := scanUser(rows, &user)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning user: %v", err)
+			return nil, dbError("error scanning user", err)
 		}
 		users = append(users, user)
 	}
@@ -140,67 +214,91 @@ func GetAllUsers() ([]User, error) {
 }
 
 // GetByID retrieves a user by ID
-func GetUserByID(id int) (*User, error) {
-	query := "SELECT id, username, full_name FROM users WHERE id = @id"
-	row := db.QueryRow(query, sql.Named("id", id))
+func GetUserByID(ctx context.Context, id int) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = @id"
+	row := db.QueryRowContext(ctx, query, sql.Named("id", id))
 
 	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.FullName)
+	err := scanUser(row, &user)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, fmt.Errorf("user %w", ErrNotFound)
 		}
-		return nil, fmt.Errorf("error querying user: %v", err)
+		return nil, dbError("error querying user", err)
 	}
 
 	return &user, nil
 }
 
 // GetUserByUsername retrieves a user by username (for login)
-func GetUserByUsername(username string) (*User, error) {
-	query := "SELECT id, username, password, full_name FROM users WHERE username = @username"
-	row := db.QueryRow(query, sql.Named("username", username))
+func GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	query := "SELECT " + userColumns + ", password FROM users WHERE username = @username"
+	row := db.QueryRowContext(ctx, query, sql.Named("username", username))
+
+	var user User
+	err := scanUser(row, &user, &user.Password)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user %w", ErrNotFound)
+		}
+		return nil, dbError("error querying user", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email address
+func GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE email = @email"
+	row := db.QueryRowContext(ctx, query, sql.Named("email", email))
 
 	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.FullName)
+	err := scanUser(row, &user)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, fmt.Errorf("user %w", ErrNotFound)
 		}
-		return nil, fmt.Errorf("error querying user: %v", err)
+		return nil, dbError("error querying user", err)
 	}
 
 	return &user, nil
 }
 
 // Update updates a user
-func (u *User) Update() error {
+func (u *User) Update(ctx context.Context) error {
 	var query string
 	var err error
 
+	// Changing the email address makes it unverified again
+	verifiedColumn := "email_verified_at = CASE WHEN email = @email THEN email_verified_at ELSE NULL END"
+
 	// If password is provided, hash it and update
 	if u.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		hashedPassword, err := utils.HashPassword(ctx, u.Password)
 		if err != nil {
 			return fmt.Errorf("error hashing password: %v", err)
 		}
-		query = "UPDATE users SET username = @username, password = @password, full_name = @fullname WHERE id = @id"
-		_, err = db.Exec(query,
+		query = "UPDATE users SET username = @username, password = @password, password_breached_at = NULL, full_name = @fullname, email = @email, " + verifiedColumn + ", role = @role WHERE id = @id"
+		_, err = db.ExecContext(ctx, query,
 			sql.Named("username", u.Username),
-			sql.Named("password", string(hashedPassword)),
+			sql.Named("password", hashedPassword),
 			sql.Named("fullname", u.FullName),
+			sql.Named("email", nullString(u.Email)),
+			sql.Named("role", u.Role),
 			sql.Named("id", u.ID))
 	} else {
 		// Update without password
-		query = "UPDATE users SET username = @username, full_name = @fullname WHERE id = @id"
-		_, err = db.Exec(query,
+		query = "UPDATE users SET username = @username, full_name = @fullname, email = @email, " + verifiedColumn + ", role = @role WHERE id = @id"
+		_, err = db.ExecContext(ctx, query,
 			sql.Named("username", u.Username),
 			sql.Named("fullname", u.FullName),
+			sql.Named("email", nullString(u.Email)),
+			sql.Named("role", u.Role),
 			sql.Named("id", u.ID))
 	}
 
 	if err != nil {
-		return fmt.Errorf("error updating user: %v", err)
+		return userDBError("error updating user", err)
 	}
 
 	u.Password = "" // Clear password from struct
@@ -208,26 +306,79 @@ func (u *User) Update() error {
 }
 
 // Delete deletes a user
-func DeleteUser(id int) error {
+func DeleteUser(ctx context.Context, id int) error {
 	query := "DELETE FROM users WHERE id = @id"
-	result, err := db.Exec(query, sql.Named("id", id))
+	result, err := db.ExecContext(ctx, query, sql.Named("id", id))
 	if err != nil {
-		return fmt.Errorf("error deleting user: %v", err)
+		return dbError("error deleting user", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error getting rows affected: %v", err)
+		return dbError("error getting rows affected", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// UpdatePasswordHash replaces a user's stored password hash, e.g. after upgrading
+// it to the current hashing algorithm or parameters
+func UpdatePasswordHash(ctx context.Context, id int, hash string) error {
+	query := "UPDATE users SET password = @password WHERE id = @id"
+	_, err := db.ExecContext(ctx, query, sql.Named("password", hash), sql.Named("id", id))
+	if err != nil {
+		return dbError("error updating password hash", err)
 	}
 
 	return nil
 }
 
+// SetPasswordBreached flags or clears a user's current password as found in a data breach
+func SetPasswordBreached(ctx context.Context, id int, breached bool) error {
+	query := `UPDATE users SET password_breached_at =
+		CASE WHEN @breached = 1 THEN ISNULL(password_breached_at, SYSUTCDATETIME()) END
+		WHERE id = @id`
+	_, err := db.ExecContext(ctx, query, sql.Named("breached", breached), sql.Named("id", id))
+	if err != nil {
+		return dbError("error updating password breach flag", err)
+	}
+
+	return nil
+}
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// CompareDummyPassword performs a password comparison that always fails. It is
+// used when a login names an unknown user, so failed logins cost the same
+// whether or not the username exists.
+func CompareDummyPassword(ctx context.Context, password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = utils.HashPassword(ctx, "dummy-password-for-timing")
+	})
+	utils.VerifyPassword(ctx, password, dummyPasswordHash)
+}
+
 // ValidatePassword checks if the provided password matches the hashed password
-func (u *User) ValidatePassword(password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
+func (u *User) ValidatePassword(ctx context.Context, password string) error {
+	ok, err := utils.VerifyPassword(ctx, password, u.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("invalid password")
+	}
+	return nil
+}
+
+// PasswordNeedsRehash reports whether the stored hash uses a weaker algorithm or
+// outdated parameters than the configured password hasher
+func (u *User) PasswordNeedsRehash() bool {
+	return utils.PasswordNeedsRehash(u.Password)
 }
@@ -0,0 +1,327 @@
+// Command mock-ldap is a minimal LDAP directory for local testing. It serves a
+// fixed set of users and groups over plain LDAP and supports simple bind and
+// search, which is all the API needs. Never expose it publicly.
+//
+// Usage:
+//
+//	go run ./tests/mock-ldap -addr :3389
+//
+// Then start the API with AUTH_CHAIN=local,ldap and the LDAP_* values printed at startup.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP protocol operations and result codes used by the mock
+const (
+	opBindRequest      = 0
+	opBindResponse     = 1
+	opUnbindRequest    = 2
+	opSearchRequest    = 3
+	opSearchResultItem = 4
+	opSearchResultDone = 5
+	opAbandonRequest   = 16
+	opExtendedRequest  = 23
+	opExtendedResponse = 24
+
+	resultSuccess                = 0
+	resultProtocolError          = 2
+	resultSizeLimitExceeded      = 4
+	resultAuthMethodNotSupported = 7
+	resultNoSuchObject           = 32
+	resultInvalidCredentials     = 49
+)
+
+// entry is a directory object with its password, if it can bind
+type entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+const baseDN = "dc=example,dc=org"
+
+// directory holds the fixture data
+var directory = []entry{
+	{DN: baseDN, Attributes: map[string][]string{
+		"objectClass": {"top", "domain"}, "dc": {"example"}}},
+	{DN: "ou=people," + baseDN, Attributes: map[string][]string{
+		"objectClass": {"top", "organizationalUnit"}, "ou": {"people"}}},
+	{DN: "ou=groups," + baseDN, Attributes: map[string][]string{
+		"objectClass": {"top", "organizationalUnit"}, "ou": {"groups"}}},
+	{DN: "cn=reader," + baseDN, Password: "reader-secret", Attributes: map[string][]string{
+		"objectClass": {"top", "applicationProcess", "simpleSecurityObject"}, "cn": {"reader"}}},
+	{DN: "uid=alice,ou=people," + baseDN, Password: "alice-password", Attributes: map[string][]string{
+		"objectClass": {"top", "person", "inetOrgPerson"},
+		"uid":         {"alice"},
+		"cn":          {"Alice Admin"},
+		"sn":          {"Admin"},
+		"mail":        {"alice@example.org"},
+		"memberOf":    {"cn=admins,ou=groups," + baseDN, "cn=staff,ou=groups," + baseDN}}},
+	{DN: "uid=bob,ou=people," + baseDN, Password: "bob-password", Attributes: map[string][]string{
+		"objectClass": {"top", "person", "inetOrgPerson"},
+		"uid":         {"bob"},
+		"cn":          {"Bob Staff"},
+		"sn":          {"Staff"},
+		"mail":        {"bob@example.org"},
+		"memberOf":    {"cn=staff,ou=groups," + baseDN}}},
+	{DN: "cn=admins,ou=groups," + baseDN, Attributes: map[string][]string{
+		"objectClass": {"top", "groupOfNames"},
+		"cn":          {"admins"},
+		"member":      {"uid=alice,ou=people," + baseDN}}},
+	{DN: "cn=staff,ou=groups," + baseDN, Attributes: map[string][]string{
+		"objectClass": {"top", "groupOfNames"},
+		"cn":          {"staff"},
+		"member":      {"uid=alice,ou=people," + baseDN, "uid=bob,ou=people," + baseDN}}},
+}
+
+func main() {
+	addr := flag.String("addr", ":3389", "listen address")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal("Failed to listen:", err)
+	}
+
+	log.Printf("Mock LDAP directory listening on %s", *addr)
+	log.Printf("LDAP_BASE_DN=%s LDAP_BIND_DN=cn=reader,%s LDAP_BIND_PASSWORD=reader-secret", baseDN, baseDN)
+	log.Printf("Users: alice/alice-password (admins, staff), bob/bob-password (staff)")
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("Accept failed: %v", err)
+			continue
+		}
+		go serve(conn)
+	}
+}
+
+// serve answers requests on one connection until the client unbinds or disconnects
+func serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			writeResult(conn, messageID, opBindResponse, bind(op), "")
+		case opSearchRequest:
+			search(conn, messageID, op)
+		case opExtendedRequest:
+			// StartTLS and other extended operations are not supported
+			writeResult(conn, messageID, opExtendedResponse, resultProtocolError, "extended operations are not supported")
+		case opAbandonRequest:
+		case opUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+// bind checks a simple bind. An empty password is an anonymous bind.
+func bind(op *ber.Packet) int {
+	if len(op.Children) < 3 {
+		return resultProtocolError
+	}
+
+	name := op.Children[1].Data.String()
+	auth := op.Children[2]
+	if auth.ClassType != ber.ClassContext || auth.Tag != 0 {
+		return resultAuthMethodNotSupported
+	}
+
+	password := auth.Data.String()
+	if password == "" {
+		return resultSuccess
+	}
+
+	e := find(name)
+	if e == nil || e.Password == "" || e.Password != password {
+		return resultInvalidCredentials
+	}
+	return resultSuccess
+}
+
+// search returns the entries under the base DN that match the filter
+func search(conn net.Conn, messageID int64, op *ber.Packet) {
+	if len(op.Children) < 8 {
+		writeResult(conn, messageID, opSearchResultDone, resultProtocolError, "")
+		return
+	}
+
+	base := op.Children[0].Data.String()
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+
+	var wanted []string
+	for _, attr := range op.Children[7].Children {
+		wanted = append(wanted, attr.Data.String())
+	}
+
+	if find(base) == nil {
+		writeResult(conn, messageID, opSearchResultDone, resultNoSuchObject, "")
+		return
+	}
+
+	sent := int64(0)
+	for i := range directory {
+		e := &directory[i]
+		if !inScope(e.DN, base, scope) || !matches(e, filter) {
+			continue
+		}
+		if sizeLimit > 0 && sent == sizeLimit {
+			writeResult(conn, messageID, opSearchResultDone, resultSizeLimitExceeded, "")
+			return
+		}
+		writeEntry(conn, messageID, e, wanted)
+		sent++
+	}
+
+	writeResult(conn, messageID, opSearchResultDone, resultSuccess, "")
+}
+
+// inScope reports whether dn is covered by a search of base with the given scope
+func inScope(dn string, base string, scope int64) bool {
+	dn, base = strings.ToLower(dn), strings.ToLower(base)
+	switch scope {
+	case 0: // baseObject
+		return dn == base
+	case 1: // singleLevel
+		parts := strings.SplitN(dn, ",", 2)
+		return len(parts) == 2 && parts[1] == base
+	default: // wholeSubtree
+		return dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+// matches evaluates an LDAP filter against an entry. Only the filter types
+// the API sends are supported: and, or, not, equality and presence.
+func matches(e *entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if !matches(e, child) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range filter.Children {
+			if matches(e, child) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return len(filter.Children) == 1 && !matches(e, filter.Children[0])
+	case 3: // equalityMatch
+		if len(filter.Children) != 2 {
+			return false
+		}
+		value := filter.Children[1].Data.String()
+		for _, v := range attribute(e, filter.Children[0].Data.String()) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		return len(attribute(e, filter.Data.String())) > 0
+	default:
+		return false
+	}
+}
+
+// attribute returns the values of an attribute, matching the name case-insensitively
+func attribute(e *entry, name string) []string {
+	for key, values := range e.Attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// find returns the entry with the given DN
+func find(dn string) *entry {
+	for i := range directory {
+		if strings.EqualFold(directory[i].DN, dn) {
+			return &directory[i]
+		}
+	}
+	return nil
+}
+
+// writeEntry sends one search result with the requested attributes
+func writeEntry(conn net.Conn, messageID int64, e *entry, wanted []string) {
+	all := len(wanted) == 0
+	for _, name := range wanted {
+		if name == "*" {
+			all = true
+		}
+	}
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for key, values := range e.Attributes {
+		if !all && !containsFold(wanted, key) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, key, "Type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultItem, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "Object Name"))
+	op.AppendChild(attrs)
+	writeMessage(conn, messageID, op)
+}
+
+// writeResult sends a response that carries only an LDAPResult
+func writeResult(conn net.Conn, messageID int64, opTag ber.Tag, code int, message string) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opTag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	writeMessage(conn, messageID, op)
+}
+
+// writeMessage wraps a protocol operation in an LDAPMessage and sends it
+func writeMessage(conn net.Conn, messageID int64, op *ber.Packet) {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	msg.AppendChild(op)
+	conn.Write(msg.Bytes())
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
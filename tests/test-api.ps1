@@ -6,7 +6,7 @@ Write-Host "Testing REST API..." -ForegroundColor Green
 Write-Host "`n1. Creating a new user..." -ForegroundColor Yellow
 $body = @{
     username = "darkpiaro"
-    password = "password123"
+    password = "BlueHarbor42"
     full_name = "Dark Piaro"
 } | ConvertTo-Json
 
@@ -22,7 +22,7 @@ try {
 Write-Host "`n2. Logging in to get JWT token..." -ForegroundColor Yellow
 $loginBody = @{
     username = "darkpiaro"
-    password = "password123"
+    password = "BlueHarbor42"
 } | ConvertTo-Json
 
 try {
@@ -0,0 +1,64 @@
+# Breached Password Screening Tests
+# Start the server with BREACHED_PASSWORDS_FILE=tests/breached-passwords-sample.txt
+# The sample corpus lists letmein2024, sunshine99, dragonfly77 and summer2023
+
+Write-Host "Testing Breached Password Screening" -ForegroundColor Green
+
+$suffix = Get-Random
+$username = "breachuser$suffix"
+
+# Test 1: Registration with a breached password is rejected
+Write-Host "`n1. Creating user with a breached password..." -ForegroundColor Yellow
+$body = @{ username = $username; password = "letmein2024"; full_name = "Breach User" } | ConvertTo-Json
+try {
+    Invoke-RestMethod -Uri "http://localhost:8080/users" -Method POST -Body $body -ContentType "application/json" | Out-Null
+    Write-Host "❌ Breached password was accepted" -ForegroundColor Red
+} catch {
+    $details = $_.ErrorDetails.Message | ConvertFrom-Json
+    if ($_.Exception.Response.StatusCode -eq 400 -and ($details.violations.rule -contains "breached")) {
+        Write-Host "✅ Breached password rejected (rule: breached)" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected error: $($_.ErrorDetails.Message)" -ForegroundColor Red
+    }
+}
+
+# Test 2: Registration with a clean password succeeds
+Write-Host "`n2. Creating user with a clean password..." -ForegroundColor Yellow
+$body = @{ username = $username; password = "QuietMeadow58"; full_name = "Breach User" } | ConvertTo-Json
+try {
+    $created = Invoke-RestMethod -Uri "http://localhost:8080/users" -Method POST -Body $body -ContentType "application/json"
+    Write-Host "✅ User created (ID: $($created.user.id))" -ForegroundColor Green
+} catch {
+    Write-Host "❌ User creation failed: $($_.ErrorDetails.Message)" -ForegroundColor Red
+    return
+}
+
+$login = Invoke-RestMethod -Uri "http://localhost:8080/login" -Method POST -ContentType "application/json" `
+    -Body (@{ username = $username; password = "QuietMeadow58" } | ConvertTo-Json)
+$headers = @{ "Authorization" = "Bearer $($login.token)" }
+
+# Test 3: Changing to a breached password is rejected
+Write-Host "`n3. Changing password to a breached one..." -ForegroundColor Yellow
+try {
+    $body = @{ password = "sunshine99" } | ConvertTo-Json
+    Invoke-RestMethod -Uri "http://localhost:8080/users/$($created.user.id)" -Method PUT -Body $body -ContentType "application/json" -Headers $headers | Out-Null
+    Write-Host "❌ Breached password was accepted" -ForegroundColor Red
+} catch {
+    if ($_.Exception.Response.StatusCode -eq 400) {
+        Write-Host "✅ Breached password rejected (400)" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected error: $($_.Exception.Message)" -ForegroundColor Red
+    }
+}
+
+# Test 4: Changing to a clean password succeeds
+Write-Host "`n4. Changing password to a clean one..." -ForegroundColor Yellow
+try {
+    $body = @{ password = "StillWater73" } | ConvertTo-Json
+    Invoke-RestMethod -Uri "http://localhost:8080/users/$($created.user.id)" -Method PUT -Body $body -ContentType "application/json" -Headers $headers | Out-Null
+    Write-Host "✅ Password changed" -ForegroundColor Green
+} catch {
+    Write-Host "❌ Password change failed: $($_.ErrorDetails.Message)" -ForegroundColor Red
+}
+
+Write-Host "`nBreached password tests completed!" -ForegroundColor Green
@@ -0,0 +1,77 @@
+# CORS and Security Header Tests
+# Start the server with CORS_ALLOWED_ORIGINS=http://localhost:3000 and CORS_ALLOW_CREDENTIALS=true
+
+Write-Host "Testing CORS and Security Headers" -ForegroundColor Green
+
+$baseUrl = "http://localhost:8080"
+$allowedOrigin = "http://localhost:3000"
+$otherOrigin = "https://evil.example.com"
+
+function Check($condition, $message) {
+    if ($condition) {
+        Write-Host "✅ $message" -ForegroundColor Green
+    } else {
+        Write-Host "❌ $message" -ForegroundColor Red
+    }
+}
+
+# Test 1: Preflight from an allowed origin is answered before authentication
+Write-Host "`n1. Preflight for GET /users from $allowedOrigin..." -ForegroundColor Yellow
+try {
+    $response = Invoke-WebRequest -Uri "$baseUrl/users" -Method OPTIONS -UseBasicParsing -Headers @{
+        "Origin" = $allowedOrigin
+        "Access-Control-Request-Method" = "GET"
+        "Access-Control-Request-Headers" = "Authorization"
+    }
+    Check ($response.StatusCode -eq 204) "Preflight answered with 204"
+    Check ($response.Headers["Access-Control-Allow-Origin"] -eq $allowedOrigin) "Origin echoed in Access-Control-Allow-Origin"
+    Check ($response.Headers["Access-Control-Allow-Credentials"] -eq "true") "Credentials allowed"
+    Check ($response.Headers["Access-Control-Allow-Headers"] -match "Authorization") "Authorization header allowed"
+    Check ([int]$response.Headers["Access-Control-Max-Age"] -gt 0) "Preflight cacheable (Max-Age: $($response.Headers["Access-Control-Max-Age"]))"
+} catch {
+    Write-Host "❌ Preflight failed: $($_.Exception.Message)" -ForegroundColor Red
+}
+
+# Test 2: Preflight from an unknown origin is refused
+Write-Host "`n2. Preflight for POST /login from $otherOrigin..." -ForegroundColor Yellow
+try {
+    Invoke-WebRequest -Uri "$baseUrl/login" -Method OPTIONS -UseBasicParsing -Headers @{
+        "Origin" = $otherOrigin
+        "Access-Control-Request-Method" = "POST"
+    } | Out-Null
+    Write-Host "❌ Preflight from unknown origin was accepted" -ForegroundColor Red
+} catch {
+    Check ($_.Exception.Response.StatusCode -eq 403) "Unknown origin refused (403)"
+}
+
+# Test 3: Actual request from an allowed origin exposes the request ID
+Write-Host "`n3. GET /healthz from $allowedOrigin..." -ForegroundColor Yellow
+$response = Invoke-WebRequest -Uri "$baseUrl/healthz" -UseBasicParsing -Headers @{ "Origin" = $allowedOrigin }
+Check ($response.Headers["Access-Control-Allow-Origin"] -eq $allowedOrigin) "Origin allowed"
+Check ($response.Headers["Access-Control-Expose-Headers"] -match "X-Request-ID") "X-Request-ID exposed to scripts"
+Check ($response.Headers["Vary"] -match "Origin") "Vary: Origin set"
+
+# Test 4: Actual request from an unknown origin gets no CORS headers
+Write-Host "`n4. GET /healthz from $otherOrigin..." -ForegroundColor Yellow
+$response = Invoke-WebRequest -Uri "$baseUrl/healthz" -UseBasicParsing -Headers @{ "Origin" = $otherOrigin }
+Check (-not $response.Headers["Access-Control-Allow-Origin"]) "No Access-Control-Allow-Origin for unknown origin"
+
+# Test 5: Security headers on API responses, including errors
+Write-Host "`n5. Security headers on API responses..." -ForegroundColor Yellow
+try {
+    Invoke-WebRequest -Uri "$baseUrl/users" -UseBasicParsing | Out-Null
+} catch {
+    $headers = $_.Exception.Response.Headers
+    Check ($_.Exception.Response.StatusCode -eq 401) "GET /users without token returns 401"
+    Check ($headers["X-Content-Type-Options"] -eq "nosniff") "X-Content-Type-Options: nosniff"
+    Check ($headers["Strict-Transport-Security"] -match "max-age=") "Strict-Transport-Security set"
+    Check ($headers["Referrer-Policy"]) "Referrer-Policy: $($headers["Referrer-Policy"])"
+    Check ($headers["Content-Security-Policy"] -match "default-src 'none'") "API Content-Security-Policy: $($headers["Content-Security-Policy"])"
+}
+
+# Test 6: Swagger UI gets a policy that lets it load its assets
+Write-Host "`n6. Security headers on swagger UI..." -ForegroundColor Yellow
+$response = Invoke-WebRequest -Uri "$baseUrl/swagger/index.html" -UseBasicParsing
+Check ($response.Headers["Content-Security-Policy"] -match "script-src 'self'") "Swagger Content-Security-Policy: $($response.Headers["Content-Security-Policy"])"
+
+Write-Host "`nCORS and security header tests completed!" -ForegroundColor Green
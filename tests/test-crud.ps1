@@ -6,7 +6,7 @@ Write-Host "Extended API Testing - CRUD Operations" -ForegroundColor Green
 Write-Host "`n1. Getting JWT token..." -ForegroundColor Yellow
 $loginBody = @{
     username = "darkpiaro"
-    password = "password123"
+    password = "BlueHarbor42"
 } | ConvertTo-Json
 
 try {
@@ -53,7 +53,7 @@ try {
 Write-Host "`n4. Creating second user for deletion test..." -ForegroundColor Yellow
 $body2 = @{
     username = "testuser2"
-    password = "password123"
+    password = "BlueHarbor42"
     full_name = "Test User 2"
 } | ConvertTo-Json
 
@@ -31,7 +31,7 @@ try {
 Write-Host "`n3. Testing duplicate username creation..." -ForegroundColor Yellow
 $duplicateUser = @{
     username = "darkpiaro_updated"  # This username already exists
-    password = "password123"
+    password = "BlueHarbor42"
     full_name = "Duplicate User"
 } | ConvertTo-Json
 
@@ -39,8 +39,12 @@ try {
     Invoke-RestMethod -Uri "http://localhost:8080/users" -Method POST -Headers @{"Content-Type"="application/json"} -Body $duplicateUser
     Write-Host "❌ Duplicate username allowed (should not happen)" -ForegroundColor Red
 } catch {
-    Write-Host "✅ Correctly rejected duplicate username" -ForegroundColor Green
-    Write-Host "Error: $($_.Exception.Response.StatusCode)" -ForegroundColor Cyan
+    $problem = $_.ErrorDetails.Message | ConvertFrom-Json
+    if ($_.Exception.Response.StatusCode -eq 409 -and $problem.code -eq "USERNAME_TAKEN") {
+        Write-Host "✅ Correctly rejected duplicate username (409 USERNAME_TAKEN)" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected response: $($_.Exception.Response.StatusCode) $($_.ErrorDetails.Message)" -ForegroundColor Red
+    }
 }
 
 # Test 4: Access non-existent user
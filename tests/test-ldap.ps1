@@ -0,0 +1,85 @@
+# LDAP Login Tests
+# Start the mock directory first:  go run ./tests/mock-ldap -addr :3389
+# Then start the server with:
+#   AUTH_CHAIN=local,ldap LDAP_URL=ldap://localhost:3389 LDAP_BASE_DN=dc=example,dc=org
+#   LDAP_BIND_DN=cn=reader,dc=example,dc=org LDAP_BIND_PASSWORD=reader-secret
+#   LDAP_GROUP_ROLES=cn=admins,ou=groups,dc=example,dc=org:admin
+
+Write-Host "Testing LDAP Login" -ForegroundColor Green
+
+# Test 1: A directory user logs in and gets a shadow account
+Write-Host "`n1. Logging in as directory user bob..." -ForegroundColor Yellow
+try {
+    $body = @{ username = "bob"; password = "bob-password" } | ConvertTo-Json
+    $bob = Invoke-RestMethod -Uri "http://localhost:8080/login" -Method POST -Body $body -ContentType "application/json"
+    if ($bob.user.auth_source -eq "ldap" -and $bob.user.role -eq "user") {
+        Write-Host "✅ Logged in as $($bob.user.username) (source: $($bob.user.auth_source), role: $($bob.user.role))" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected user: $($bob.user | ConvertTo-Json -Compress)" -ForegroundColor Red
+    }
+} catch {
+    Write-Host "❌ LDAP login failed: $($_.Exception.Message)" -ForegroundColor Red
+    return
+}
+
+# Test 2: Attributes are copied from the directory
+Write-Host "`n2. Checking synced attributes..." -ForegroundColor Yellow
+if ($bob.user.full_name -eq "Bob Staff" -and $bob.user.email -eq "bob@example.org") {
+    Write-Host "✅ Full name and email synced" -ForegroundColor Green
+} else {
+    Write-Host "❌ Attributes not synced: $($bob.user.full_name) / $($bob.user.email)" -ForegroundColor Red
+}
+
+# Test 3: Group membership maps to the admin role
+Write-Host "`n3. Logging in as alice (member of cn=admins)..." -ForegroundColor Yellow
+try {
+    $body = @{ username = "alice"; password = "alice-password" } | ConvertTo-Json
+    $alice = Invoke-RestMethod -Uri "http://localhost:8080/login" -Method POST -Body $body -ContentType "application/json"
+    if ($alice.user.role -eq "admin") {
+        Write-Host "✅ alice received the admin role" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Expected admin role, got $($alice.user.role)" -ForegroundColor Red
+    }
+} catch {
+    Write-Host "❌ LDAP login failed: $($_.Exception.Message)" -ForegroundColor Red
+}
+
+# Test 4: A second login reuses the same shadow account
+Write-Host "`n4. Logging in as bob again..." -ForegroundColor Yellow
+$body = @{ username = "bob"; password = "bob-password" } | ConvertTo-Json
+$again = Invoke-RestMethod -Uri "http://localhost:8080/login" -Method POST -Body $body -ContentType "application/json"
+if ($again.user.id -eq $bob.user.id) {
+    Write-Host "✅ Same user returned" -ForegroundColor Green
+} else {
+    Write-Host "❌ Expected user $($bob.user.id), got $($again.user.id)" -ForegroundColor Red
+}
+
+# Test 5: A wrong directory password is rejected
+Write-Host "`n5. Logging in with a wrong password..." -ForegroundColor Yellow
+try {
+    $body = @{ username = "bob"; password = "wrong-password" } | ConvertTo-Json
+    Invoke-RestMethod -Uri "http://localhost:8080/login" -Method POST -Body $body -ContentType "application/json" | Out-Null
+    Write-Host "❌ Wrong password was accepted" -ForegroundColor Red
+} catch {
+    if ($_.Exception.Response.StatusCode -eq 401) {
+        Write-Host "✅ Wrong password rejected (401)" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected error: $($_.Exception.Message)" -ForegroundColor Red
+    }
+}
+
+# Test 6: Directory users cannot change their password through the API
+Write-Host "`n6. Changing bob's password through the API..." -ForegroundColor Yellow
+try {
+    $body = @{ password = "new-password-123" } | ConvertTo-Json
+    Invoke-RestMethod -Uri "http://localhost:8080/users/$($bob.user.id)" -Method PUT -Body $body -ContentType "application/json" -Headers @{"Authorization"="Bearer $($bob.token)"} | Out-Null
+    Write-Host "❌ Password change was accepted" -ForegroundColor Red
+} catch {
+    if ($_.Exception.Response.StatusCode -eq 400) {
+        Write-Host "✅ Password change rejected (400)" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected error: $($_.Exception.Message)" -ForegroundColor Red
+    }
+}
+
+Write-Host "`nLDAP tests completed!" -ForegroundColor Green
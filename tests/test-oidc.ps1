@@ -0,0 +1,68 @@
+# OpenID Connect Login Tests
+# Start the mock provider first:  go run ./tests/mock-oidc -addr :9000
+# Then start the server with OIDC_ISSUER=http://localhost:9000 and OIDC_CLIENT_ID=mock-client
+
+Write-Host "Testing OpenID Connect Login" -ForegroundColor Green
+
+$suffix = Get-Random
+$username = "oidcuser$suffix"
+
+# Test 1: Full login through the mock provider provisions a new user
+Write-Host "`n1. Logging in through the mock provider as $username..." -ForegroundColor Yellow
+try {
+    # The web session keeps the state cookie across the provider round trip
+    $session = New-Object Microsoft.PowerShell.Commands.WebRequestSession
+    $response = Invoke-WebRequest -Uri "http://localhost:8080/login/oidc?login_hint=$username" -WebSession $session -UseBasicParsing
+    $login = $response.Content | ConvertFrom-Json
+    if ($login.token -and $login.user.username -eq $username) {
+        Write-Host "✅ Logged in and provisioned user $($login.user.username) (ID: $($login.user.id))" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected login response: $($response.Content)" -ForegroundColor Red
+        return
+    }
+} catch {
+    Write-Host "❌ OIDC login failed: $($_.Exception.Message)" -ForegroundColor Red
+    return
+}
+
+# Test 2: The provisioned email is verified
+Write-Host "`n2. Checking provisioned email..." -ForegroundColor Yellow
+if ($login.user.email -eq "$username@example.com" -and $login.user.email_verified) {
+    Write-Host "✅ Email is set and verified" -ForegroundColor Green
+} else {
+    Write-Host "❌ Email not set or not verified" -ForegroundColor Red
+}
+
+# Test 3: A second login reuses the same linked user
+Write-Host "`n3. Logging in again..." -ForegroundColor Yellow
+$session = New-Object Microsoft.PowerShell.Commands.WebRequestSession
+$second = (Invoke-WebRequest -Uri "http://localhost:8080/login/oidc?login_hint=$username" -WebSession $session -UseBasicParsing).Content | ConvertFrom-Json
+if ($second.user.id -eq $login.user.id) {
+    Write-Host "✅ Same user returned" -ForegroundColor Green
+} else {
+    Write-Host "❌ Expected user $($login.user.id), got $($second.user.id)" -ForegroundColor Red
+}
+
+# Test 4: The access token works on protected routes
+Write-Host "`n4. Using the access token..." -ForegroundColor Yellow
+try {
+    $user = Invoke-RestMethod -Uri "http://localhost:8080/users/$($login.user.id)" -Headers @{"Authorization"="Bearer $($login.token)"}
+    Write-Host "✅ Protected route accessible as $($user.user.username)" -ForegroundColor Green
+} catch {
+    Write-Host "❌ Protected route failed: $($_.Exception.Message)" -ForegroundColor Red
+}
+
+# Test 5: A callback without the state cookie is rejected
+Write-Host "`n5. Replaying a callback without the state cookie..." -ForegroundColor Yellow
+try {
+    Invoke-RestMethod -Uri "http://localhost:8080/login/oidc/callback?code=forged&state=forged" | Out-Null
+    Write-Host "❌ Forged callback was accepted" -ForegroundColor Red
+} catch {
+    if ($_.Exception.Response.StatusCode -eq 400) {
+        Write-Host "✅ Forged callback rejected (400)" -ForegroundColor Green
+    } else {
+        Write-Host "❌ Unexpected error: $($_.Exception.Message)" -ForegroundColor Red
+    }
+}
+
+Write-Host "`nOpenID Connect tests completed!" -ForegroundColor Green
@@ -0,0 +1,86 @@
+# Password Reset Tests
+# Start the server with MAIL_DRIVER=file and MAIL_FILE=mail.log so the reset token can be read back
+
+Write-Host "Testing Password Reset Flow" -ForegroundColor Green
+
+$mailFile = "mail.log"
+$suffix = Get-Random
+
+# Test 1: Create a user with an email address
+Write-Host "`n1. Creating user with email..." -ForegroundColor Yellow
+$username = "resetuser$suffix"
+$body = @{
+    username = $username
+    password = "BlueHarbor42"
+    full_name = "Reset User"
+    email = "$username@example.com"
+} | ConvertTo-Json
+
+try {
+    Invoke-RestMethod -Uri "http://localhost:8080/users" -Method POST -Headers @{"Content-Type"="application/json"} -Body $body | Out-Null
+    Write-Host "✅ User created" -ForegroundColor Green
+} catch {
+    Write-Host "❌ Failed to create user: $($_.Exception.Message)" -ForegroundColor Red
+    return
+}
+
+# Test 2: Unknown and known accounts get the same response
+Write-Host "`n2. Requesting reset for unknown and known accounts..." -ForegroundColor Yellow
+$unknown = Invoke-RestMethod -Uri "http://localhost:8080/password/forgot" -Method POST -Headers @{"Content-Type"="application/json"} -Body (@{ email = "nobody$suffix@example.com" } | ConvertTo-Json)
+$known = Invoke-RestMethod -Uri "http://localhost:8080/password/forgot" -Method POST -Headers @{"Content-Type"="application/json"} -Body (@{ email = "$username@example.com" } | ConvertTo-Json)
+if ($unknown.message -eq $known.message) {
+    Write-Host "✅ Responses do not reveal whether the account exists" -ForegroundColor Green
+} else {
+    Write-Host "❌ Responses differ for unknown and known accounts" -ForegroundColor Red
+}
+
+# Test 3: Read the token from the mail file
+Write-Host "`n3. Reading reset token from $mailFile..." -ForegroundColor Yellow
+Start-Sleep -Seconds 2
+$matches = Select-String -Path $mailFile -Pattern "Reset token: (\S+)" | Select-Object -Last 1
+if (-not $matches) {
+    Write-Host "❌ No reset email found in $mailFile" -ForegroundColor Red
+    return
+}
+$token = $matches.Matches[0].Groups[1].Value
+Write-Host "✅ Token found" -ForegroundColor Green
+
+# Test 4: Reset the password
+Write-Host "`n4. Resetting password..." -ForegroundColor Yellow
+$resetBody = @{
+    token = $token
+    new_password = "GreenValley73"
+} | ConvertTo-Json
+
+try {
+    Invoke-RestMethod -Uri "http://localhost:8080/password/reset" -Method POST -Headers @{"Content-Type"="application/json"} -Body $resetBody | Out-Null
+    Write-Host "✅ Password reset successfully" -ForegroundColor Green
+} catch {
+    Write-Host "❌ Reset failed: $($_.Exception.Message)" -ForegroundColor Red
+}
+
+# Test 5: Login with the new password
+Write-Host "`n5. Logging in with new password..." -ForegroundColor Yellow
+$loginBody = @{
+    username = $username
+    password = "GreenValley73"
+} | ConvertTo-Json
+
+try {
+    Invoke-RestMethod -Uri "http://localhost:8080/login" -Method POST -Headers @{"Content-Type"="application/json"} -Body $loginBody | Out-Null
+    Write-Host "✅ Login with new password succeeded" -ForegroundColor Green
+} catch {
+    Write-Host "❌ Login failed: $($_.Exception.Message)" -ForegroundColor Red
+}
+
+# Test 6: The token cannot be used twice
+Write-Host "`n6. Reusing the reset token..." -ForegroundColor Yellow
+try {
+    Invoke-RestMethod -Uri "http://localhost:8080/password/reset" -Method POST -Headers @{"Content-Type"="application/json"} -Body $resetBody
+    Write-Host "❌ Token accepted twice (should not happen)" -ForegroundColor Red
+} catch {
+    Write-Host "✅ Correctly rejected used token" -ForegroundColor Green
+    Write-Host "Error: $($_.Exception.Response.StatusCode)" -ForegroundColor Cyan
+}
+
+Write-Host "`n🔑 Password reset testing completed!" -ForegroundColor Green
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Error codes are part of the API contract: clients match on them, so existing
+// codes must not change meaning. The detail text is for humans and may change.
+const (
+	// Generic
+	CodeInvalidRequest     = "INVALID_REQUEST"
+	CodeValidationFailed   = "VALIDATION_FAILED"
+	CodeInvalidID          = "INVALID_ID"
+	CodeNotFound           = "NOT_FOUND"
+	CodeConflict           = "CONFLICT"
+	CodeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeRateLimited        = "RATE_LIMITED"
+	CodeOriginNotAllowed   = "ORIGIN_NOT_ALLOWED"
+	CodeInternalError      = "INTERNAL_ERROR"
+	CodeServiceUnavailable = "SERVICE_UNAVAILABLE"
+
+	// Authentication
+	CodeAuthRequired         = "AUTH_REQUIRED"
+	CodeInvalidToken         = "INVALID_TOKEN"
+	CodeSessionRevoked       = "SESSION_REVOKED"
+	CodeInvalidAPIKey        = "INVALID_API_KEY"
+	CodeOAuthClientRevoked   = "OAUTH_CLIENT_REVOKED"
+	CodeInvalidCredentials   = "INVALID_CREDENTIALS"
+	CodeEmailNotVerified     = "EMAIL_NOT_VERIFIED"
+	CodeLoginLocked          = "LOGIN_LOCKED"
+	CodeInvalidMFAToken      = "INVALID_MFA_TOKEN"
+	CodeInvalidMFACode       = "INVALID_MFA_CODE"
+	CodeMFACodeReused        = "MFA_CODE_REUSED"
+	CodeMFAAlreadyEnabled    = "MFA_ALREADY_ENABLED"
+	CodeMFANotEnabled        = "MFA_NOT_ENABLED"
+	CodeMFANotPending        = "MFA_ENROLLMENT_NOT_PENDING"
+	CodeInvalidResetToken    = "INVALID_RESET_TOKEN"
+	CodeInvalidVerification  = "INVALID_VERIFICATION_TOKEN"
+	CodeOIDCNotConfigured    = "OIDC_NOT_CONFIGURED"
+	CodeOIDCUnavailable      = "OIDC_PROVIDER_UNAVAILABLE"
+	CodeOIDCLoginFailed      = "OIDC_LOGIN_FAILED"
+	CodeInvalidOIDCState     = "INVALID_OIDC_STATE"
+	CodeOIDCAccountNotLinked = "OIDC_ACCOUNT_NOT_LINKED"
+	CodeOIDCAccountConflict  = "OIDC_ACCOUNT_CONFLICT"
+
+	// Users
+	CodeUserNotFound            = "USER_NOT_FOUND"
+	CodeUsernameTaken           = "USERNAME_TAKEN"
+	CodeEmailTaken              = "EMAIL_TAKEN"
+	CodeRegistrationClosed      = "REGISTRATION_CLOSED"
+	CodeInvitationRequired      = "INVITATION_REQUIRED"
+	CodeInvalidInvitation       = "INVALID_INVITATION"
+	CodePasswordPolicy          = "PASSWORD_POLICY_VIOLATION"
+	CodeDirectoryManaged        = "DIRECTORY_MANAGED_USER"
+	CodeImpersonationRestricted = "IMPERSONATION_RESTRICTED"
+	CodeImpersonationNotAllowed = "IMPERSONATION_NOT_ALLOWED"
+	CodeRoleChangeForbidden     = "ROLE_CHANGE_FORBIDDEN"
+	CodeInvalidRole             = "INVALID_ROLE"
+
+	// Admin resources
+	CodeInvalidScope        = "INVALID_SCOPE"
+	CodeInvalidExpiry       = "INVALID_EXPIRY"
+	CodeInvalidGrantType    = "INVALID_GRANT_TYPE"
+	CodeInvalidRedirectURI  = "INVALID_REDIRECT_URI"
+	CodeInvalidClientConfig = "INVALID_CLIENT_CONFIG"
+	CodeAPIKeyNotFound      = "API_KEY_NOT_FOUND"
+	CodeInvitationNotFound  = "INVITATION_NOT_FOUND"
+	CodeOAuthClientNotFound = "OAUTH_CLIENT_NOT_FOUND"
+	CodeSessionNotFound     = "SESSION_NOT_FOUND"
+)
+
+// FieldError describes why one request field was rejected
+type FieldError struct {
+	Field   string `json:"field" example:"email"`
+	Rule    string `json:"rule" example:"email"`
+	Message string `json:"message" example:"must be a valid email address"`
+}
+
+// Problem is the RFC 7807 application/problem+json body of every error response
+type Problem struct {
+	Type      string       `json:"type" example:"about:blank"`
+	Title     string       `json:"title" example:"Not Found"`
+	Status    int          `json:"status" example:"404"`
+	Detail    string       `json:"detail,omitempty" example:"User not found"`
+	Instance  string       `json:"instance,omitempty" example:"/users/42"`
+	Code      string       `json:"code" example:"USER_NOT_FOUND"`
+	RequestID string       `json:"request_id,omitempty" example:"3f2a9c1e7b4d8a60"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// APIError is an error reported to the client as a problem. Err holds the
+// underlying cause, which is logged but never sent to the client.
+type APIError struct {
+	Status     int
+	Code       string
+	Detail     string
+	Fields     []FieldError
+	Extensions map[string]interface{}
+	Err        error
+}
+
+// NewAPIError creates an error with an HTTP status, a stable code and a human-readable detail
+func NewAPIError(status int, code string, detail string) *APIError {
+	return &APIError{Status: status, Code: code, Detail: detail}
+}
+
+// InternalError reports a failure the client cannot fix. Only detail is sent to the client.
+func InternalError(detail string, err error) *APIError {
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternalError, Detail: detail, Err: err}
+}
+
+// InvalidRequestError reports a request body that could not be bound, with
+// one entry per rejected field when the body parsed but failed validation
+func InvalidRequestError(err error) *APIError {
+	apiErr := &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "Invalid request format", Err: err}
+
+	var validationErrors validator.ValidationErrors
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrors):
+		apiErr.Code = CodeValidationFailed
+		apiErr.Detail = "One or more fields are invalid"
+		for _, fe := range validationErrors {
+			apiErr.Fields = append(apiErr.Fields, FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Message: fieldMessage(fe),
+			})
+		}
+	case errors.As(err, &typeError):
+		apiErr.Code = CodeValidationFailed
+		apiErr.Detail = "One or more fields are invalid"
+		apiErr.Fields = []FieldError{{Field: typeError.Field, Rule: "type", Message: "must be of type " + typeError.Type.String()}}
+	case errors.As(err, &syntaxError):
+		apiErr.Detail = "Request body is not valid JSON"
+	case errors.Is(err, io.EOF):
+		apiErr.Detail = "Request body is required"
+	}
+
+	return apiErr
+}
+
+// WithCause records the underlying error for the logs
+func (e *APIError) WithCause(err error) *APIError {
+	e.Err = err
+	return e
+}
+
+// With adds an extension member to the problem body
+func (e *APIError) With(key string, value interface{}) *APIError {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]interface{})
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// Error describes the error for logs, including the cause
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("%s (%d): %s", e.Code, e.Status, e.Detail)
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+// Unwrap returns the underlying cause
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Problem builds the response body for a request
+func (e *APIError) Problem(instance string, requestID string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  instance,
+		Code:      e.Code,
+		RequestID: requestID,
+		Errors:    e.Fields,
+	}
+}
+
+// AbortWithError stops the handler chain and records err for the error handling
+// middleware, which writes the response. Errors that are not an *APIError are
+// reported as internal errors without their text.
+func AbortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// UseJSONFieldNames makes gin's validator report fields by their json tag, so
+// validation errors name fields the way clients send them
+func UseJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+// fieldMessage explains a validation rule in plain words
+func fieldMessage(fe validator.FieldError) string {
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return "must be at least " + fe.Param() + unit
+	case "max":
+		return "must be at most " + fe.Param() + unit
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	default:
+		return "failed the " + fe.Tag() + " rule"
+	}
+}
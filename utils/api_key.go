@@ -0,0 +1,33 @@
+package utils
+
+// apiKeyPrefix marks strings issued by this service as API keys
+const apiKeyPrefix = "sra_"
+
+// GenerateAPIKey creates a new random API key. It returns the full key, which
+// must be shown to the caller exactly once, a short display prefix and the
+// hash that is stored in the database.
+func GenerateAPIKey() (key string, prefix string, hash string, err error) {
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = apiKeyPrefix + secret
+	prefix = key[:len(apiKeyPrefix)+8]
+
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash of an API key.
+// API keys are high-entropy random values, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	return HashToken(key)
+}
+
+// ExtractAPIKeyFromHeader extracts an API key from an "ApiKey <key>" Authorization header
+func ExtractAPIKeyFromHeader(authHeader string) string {
+	if len(authHeader) > 7 && authHeader[:7] == "ApiKey " {
+		return authHeader[7:]
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// backgroundTasks tracks work started by requests that finishes after the response.
+// backgroundClosed is set once shutdown starts waiting, since WaitGroup.Add must not race with Wait.
+var (
+	backgroundTasks  sync.WaitGroup
+	backgroundMu     sync.Mutex
+	backgroundClosed bool
+)
+
+// RunInBackground runs fn in a new goroutine that graceful shutdown waits for.
+// Use it for work that outlives the request, such as sending email, so a
+// deploy does not cut it off or close the database underneath it. fn receives
+// ctx without its cancellation, so it keeps the request ID and trace but is not
+// aborted when the response has been sent.
+//
+// Once shutdown is waiting for background tasks, fn runs synchronously instead,
+// so handlers still running past the shutdown deadline do not lose the work.
+func RunInBackground(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+
+	backgroundMu.Lock()
+	if backgroundClosed {
+		backgroundMu.Unlock()
+		fn(ctx)
+		return
+	}
+	backgroundTasks.Add(1)
+	backgroundMu.Unlock()
+
+	go func() {
+		defer backgroundTasks.Done()
+		fn(ctx)
+	}()
+}
+
+// WaitForBackgroundTasks blocks until every background task has finished or ctx is done
+func WaitForBackgroundTasks(ctx context.Context) error {
+	backgroundMu.Lock()
+	backgroundClosed = true
+	backgroundMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		backgroundTasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
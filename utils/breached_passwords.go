@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// The corpus is a local copy of the Have I Been Pwned "Pwned Passwords" SHA-1
+// list, ordered by hash, with one "HASH:COUNT" line per password. A small index
+// file next to it records where each 5-hex-digit hash prefix starts, so a lookup
+// reads two offsets and one block of the corpus instead of scanning it.
+const (
+	breachedIndexMagic  = "PWNDIDX1"
+	breachedIndexHeader = 24      // magic, corpus size, corpus modification time
+	breachedPrefixes    = 1 << 20 // number of 5-hex-digit hash prefixes
+	breachedMaxBlock    = 16 << 20
+)
+
+// BreachedPasswords looks up passwords in an indexed breach corpus
+type BreachedPasswords struct {
+	corpus *os.File
+	index  *os.File
+}
+
+// breachedPasswords is the corpus used by the password policy, nil when screening is disabled
+var breachedPasswords *BreachedPasswords
+
+// InitBreachedPasswords opens the corpus named by BREACHED_PASSWORDS_FILE, building
+// its index first when needed. Screening is disabled when the variable is not set.
+func InitBreachedPasswords() error {
+	path := GetEnv("BREACHED_PASSWORDS_FILE", "")
+	if path == "" {
+		return nil
+	}
+
+	b, err := OpenBreachedPasswords(path)
+	if err != nil {
+		return err
+	}
+
+	breachedPasswords = b
+	log.Printf("Breached password screening enabled using %s", path)
+	return nil
+}
+
+// BreachedPasswordCount returns how often the password appears in the breach
+// corpus. It returns 0 when screening is disabled or the lookup fails.
+func BreachedPasswordCount(password string) int {
+	if breachedPasswords == nil {
+		return 0
+	}
+
+	count, err := breachedPasswords.Count(password)
+	if err != nil {
+		log.Printf("Breached password lookup failed: %v", err)
+		return 0
+	}
+	return count
+}
+
+// OpenBreachedPasswords opens a corpus file and its index (path + ".idx"). The
+// index is rebuilt when it is missing or the corpus has changed since it was built.
+func OpenBreachedPasswords(path string) (*BreachedPasswords, error) {
+	corpus, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password corpus: %v", err)
+	}
+	info, err := corpus.Stat()
+	if err != nil {
+		corpus.Close()
+		return nil, fmt.Errorf("error reading breached password corpus: %v", err)
+	}
+
+	indexPath := path + ".idx"
+	index, err := openBreachedIndex(indexPath, info)
+	if err != nil {
+		log.Printf("Building breached password index %s, this may take a while...", indexPath)
+		if err := buildBreachedIndex(corpus, info, indexPath); err != nil {
+			corpus.Close()
+			return nil, err
+		}
+		index, err = openBreachedIndex(indexPath, info)
+		if err != nil {
+			corpus.Close()
+			return nil, err
+		}
+	}
+
+	return &BreachedPasswords{corpus: corpus, index: index}, nil
+}
+
+// Count returns how often the password appears in the corpus, or 0 if it does not
+func (b *BreachedPasswords) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := []byte(hex.EncodeToString(sum[:]))
+	prefix := int(sum[0])<<12 | int(sum[1])<<4 | int(sum[2]>>4)
+
+	var offsets [16]byte
+	if _, err := b.index.ReadAt(offsets[:], breachedIndexHeader+int64(prefix)*8); err != nil {
+		return 0, fmt.Errorf("error reading breached password index: %v", err)
+	}
+	start := int64(binary.LittleEndian.Uint64(offsets[:8]))
+	end := int64(binary.LittleEndian.Uint64(offsets[8:]))
+	if end <= start {
+		return 0, nil
+	}
+	if end-start > breachedMaxBlock {
+		return 0, fmt.Errorf("breached password index block for prefix %05X is too large", prefix)
+	}
+
+	block := make([]byte, end-start)
+	if _, err := b.corpus.ReadAt(block, start); err != nil {
+		return 0, fmt.Errorf("error reading breached password corpus: %v", err)
+	}
+
+	for _, line := range bytes.Split(block, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) < 42 || line[40] != ':' || !bytes.EqualFold(line[:40], hash) {
+			continue
+		}
+		count, err := strconv.Atoi(string(line[41:]))
+		if err != nil {
+			return 0, fmt.Errorf("invalid count in breached password corpus: %q", line)
+		}
+		return count, nil
+	}
+
+	return 0, nil
+}
+
+// Close closes the corpus and index files
+func (b *BreachedPasswords) Close() error {
+	b.index.Close()
+	return b.corpus.Close()
+}
+
+// openBreachedIndex opens an index and checks that it was built for the corpus as it is now
+func openBreachedIndex(path string, corpus os.FileInfo) (*os.File, error) {
+	index, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, breachedIndexHeader)
+	info, err := index.Stat()
+	if err == nil {
+		_, err = io.ReadFull(index, header)
+	}
+	if err != nil {
+		index.Close()
+		return nil, fmt.Errorf("error reading breached password index: %v", err)
+	}
+
+	if string(header[:8]) != breachedIndexMagic ||
+		int64(binary.LittleEndian.Uint64(header[8:16])) != corpus.Size() ||
+		int64(binary.LittleEndian.Uint64(header[16:24])) != corpus.ModTime().UnixNano() ||
+		info.Size() != breachedIndexHeader+(breachedPrefixes+1)*8 {
+		index.Close()
+		return nil, fmt.Errorf("breached password index %s is out of date", path)
+	}
+
+	return index, nil
+}
+
+// buildBreachedIndex scans the corpus once and writes the offset of the first
+// line of every hash prefix. The corpus must be sorted by hash.
+func buildBreachedIndex(corpus *os.File, info os.FileInfo, path string) error {
+	if _, err := corpus.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading breached password corpus: %v", err)
+	}
+
+	offsets := make([]uint64, breachedPrefixes+1)
+	next := 0 // first prefix whose offset is not yet known
+	var pos uint64
+	lineStart := true
+
+	reader := bufio.NewReaderSize(corpus, 1<<20)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if lineStart && len(line) >= 5 {
+			prefix, perr := strconv.ParseUint(string(line[:5]), 16, 32)
+			if perr != nil {
+				return fmt.Errorf("invalid line in breached password corpus at byte %d", pos)
+			}
+			if int(prefix) < next-1 {
+				return fmt.Errorf("breached password corpus is not sorted by hash at byte %d", pos)
+			}
+			for ; next <= int(prefix); next++ {
+				offsets[next] = pos
+			}
+		}
+		pos += uint64(len(line))
+		lineStart = err != bufio.ErrBufferFull
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return fmt.Errorf("error reading breached password corpus: %v", err)
+		}
+	}
+	for ; next <= breachedPrefixes; next++ {
+		offsets[next] = pos
+	}
+
+	// Write to a temporary file first so a half-written index is never used
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".breached-index-*")
+	if err != nil {
+		return fmt.Errorf("error creating breached password index: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	writer.WriteString(breachedIndexMagic)
+	binary.Write(writer, binary.LittleEndian, uint64(info.Size()))
+	binary.Write(writer, binary.LittleEndian, uint64(info.ModTime().UnixNano()))
+	binary.Write(writer, binary.LittleEndian, offsets)
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing breached password index: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing breached password index: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error saving breached password index: %v", err)
+	}
+	return nil
+}
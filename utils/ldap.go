@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrLDAPInvalidCredentials is returned when the directory rejects the username or password
+var ErrLDAPInvalidCredentials = errors.New("invalid LDAP credentials")
+
+// LDAPConfig holds the directory connection and user lookup settings
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	CAFile             string
+	Timeout            time.Duration
+
+	// BindMode is "search" (find the user with a service account, then bind as
+	// them) or "direct" (bind as UserDNTemplate filled with the username)
+	BindMode       string
+	UserDNTemplate string
+	BindDN         string
+	BindPassword   string
+
+	BaseDN       string
+	UserFilter   string
+	GroupBaseDN  string
+	GroupFilter  string // optional group search for servers without memberOf
+	AttrUsername string
+	AttrFullName string
+	AttrEmail    string
+	AttrMemberOf string
+
+	// GroupRoles maps lower-cased group DNs to user roles
+	GroupRoles map[string]string
+}
+
+// GetLDAPConfig reads the directory settings from environment variables
+func GetLDAPConfig() LDAPConfig {
+	return LDAPConfig{
+		URL:                GetEnv("LDAP_URL", "ldap://localhost:389"),
+		StartTLS:           GetEnvBool("LDAP_START_TLS", false),
+		InsecureSkipVerify: GetEnvBool("LDAP_INSECURE_SKIP_VERIFY", false),
+		CAFile:             GetEnv("LDAP_CA_FILE", ""),
+		Timeout:            GetEnvDuration("LDAP_TIMEOUT", 5*time.Second),
+		BindMode:           GetEnv("LDAP_BIND_MODE", "search"),
+		UserDNTemplate:     GetEnv("LDAP_USER_DN_TEMPLATE", ""),
+		BindDN:             GetEnv("LDAP_BIND_DN", ""),
+		BindPassword:       GetEnv("LDAP_BIND_PASSWORD", ""),
+		BaseDN:             GetEnv("LDAP_BASE_DN", ""),
+		UserFilter:         GetEnv("LDAP_USER_FILTER", "(&(objectClass=person)(uid=%s))"),
+		GroupBaseDN:        GetEnv("LDAP_GROUP_BASE_DN", GetEnv("LDAP_BASE_DN", "")),
+		GroupFilter:        GetEnv("LDAP_GROUP_FILTER", ""),
+		AttrUsername:       GetEnv("LDAP_ATTR_USERNAME", "uid"),
+		AttrFullName:       GetEnv("LDAP_ATTR_FULL_NAME", "cn"),
+		AttrEmail:          GetEnv("LDAP_ATTR_EMAIL", "mail"),
+		AttrMemberOf:       GetEnv("LDAP_ATTR_MEMBER_OF", "memberOf"),
+		GroupRoles:         parseGroupRoles(GetEnv("LDAP_GROUP_ROLES", "")),
+	}
+}
+
+// LDAPEntry is a directory user who has just authenticated
+type LDAPEntry struct {
+	DN       string
+	Username string
+	FullName string
+	Email    string
+	Groups   []string
+}
+
+// LDAPAuthenticate checks a username and password against the directory and
+// returns the user's attributes and group memberships. It returns
+// ErrLDAPInvalidCredentials for unknown users and wrong passwords; any other
+// error means the directory could not be reached or is misconfigured.
+func LDAPAuthenticate(cfg LDAPConfig, username string, password string) (*LDAPEntry, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := dialLDAP(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var entry *LDAPEntry
+	if cfg.BindMode == "direct" {
+		entry, err = ldapDirectBind(conn, cfg, username, password)
+	} else {
+		entry, err = ldapSearchBind(conn, cfg, username, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Groups from a separate search supplement memberOf
+	if cfg.GroupFilter != "" && cfg.GroupBaseDN != "" {
+		if cfg.BindDN != "" {
+			if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+				return nil, fmt.Errorf("error binding LDAP service account: %v", err)
+			}
+		}
+		groups, err := ldapSearch(conn, cfg.GroupBaseDN, fmt.Sprintf(cfg.GroupFilter, ldap.EscapeFilter(entry.DN)), []string{"dn"})
+		if err != nil {
+			return nil, fmt.Errorf("error searching LDAP groups: %v", err)
+		}
+		for _, group := range groups {
+			entry.Groups = append(entry.Groups, group.DN)
+		}
+	}
+
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	return entry, nil
+}
+
+// RoleForGroups returns the role mapped to the user's groups, preferring the
+// role listed in priority order. It returns "" when no group is mapped.
+func (cfg LDAPConfig) RoleForGroups(groups []string, priority ...string) string {
+	mapped := map[string]bool{}
+	for _, group := range groups {
+		if role, ok := cfg.GroupRoles[strings.ToLower(group)]; ok {
+			mapped[role] = true
+		}
+	}
+	for _, role := range priority {
+		if mapped[role] {
+			return role
+		}
+	}
+	return ""
+}
+
+// ldapSearchBind finds the user with the service account, then binds as them
+func ldapSearchBind(conn *ldap.Conn, cfg LDAPConfig, username string, password string) (*LDAPEntry, error) {
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("error binding LDAP service account: %v", err)
+		}
+	}
+
+	entries, err := ldapSearch(conn, cfg.BaseDN, fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(username)), cfg.userAttributes())
+	if err != nil {
+		return nil, fmt.Errorf("error searching LDAP user: %v", err)
+	}
+	if len(entries) != 1 {
+		// Unknown or ambiguous usernames are treated as a failed login
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	err = conn.Bind(entries[0].DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("error binding LDAP user: %v", err)
+	}
+
+	return cfg.toEntry(entries[0]), nil
+}
+
+// ldapDirectBind binds with a DN built from the username, then reads the user's
+// attributes when a base DN is configured
+func ldapDirectBind(conn *ldap.Conn, cfg LDAPConfig, username string, password string) (*LDAPEntry, error) {
+	if cfg.UserDNTemplate == "" {
+		return nil, fmt.Errorf("LDAP_USER_DN_TEMPLATE is required for direct bind")
+	}
+
+	bindDN := fmt.Sprintf(cfg.UserDNTemplate, ldap.EscapeDN(username))
+	err := conn.Bind(bindDN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("error binding LDAP user: %v", err)
+	}
+
+	if cfg.BaseDN == "" {
+		return &LDAPEntry{DN: bindDN, Username: username}, nil
+	}
+
+	entries, err := ldapSearch(conn, cfg.BaseDN, fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(username)), cfg.userAttributes())
+	if err != nil {
+		return nil, fmt.Errorf("error searching LDAP user: %v", err)
+	}
+	if len(entries) != 1 {
+		return &LDAPEntry{DN: bindDN, Username: username}, nil
+	}
+
+	return cfg.toEntry(entries[0]), nil
+}
+
+// LDAPPing checks that the directory is reachable and, in search mode, that the
+// service account can bind. It is used by the readiness probe.
+func LDAPPing(cfg LDAPConfig) error {
+	conn, err := dialLDAP(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if cfg.BindMode != "direct" && cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return fmt.Errorf("error binding LDAP service account: %v", err)
+		}
+	}
+	return nil
+}
+
+// ldapPlaintextWarning logs the missing-TLS warning only once
+var ldapPlaintextWarning sync.Once
+
+// dialLDAP connects to the directory, using TLS for ldaps:// URLs or StartTLS when enabled
+func dialLDAP(cfg LDAPConfig) (*ldap.Conn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP_URL: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading LDAP_CA_FILE: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in LDAP_CA_FILE")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	conn, err := ldap.DialURL(cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to LDAP: %v", err)
+	}
+	conn.SetTimeout(cfg.Timeout)
+
+	if cfg.StartTLS && u.Scheme != "ldaps" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error starting TLS with LDAP: %v", err)
+		}
+	} else if u.Scheme != "ldaps" {
+		ldapPlaintextWarning.Do(func() {
+			log.Printf("Warning: LDAP passwords are sent without TLS; set LDAP_START_TLS=true or use ldaps://")
+		})
+	}
+
+	return conn, nil
+}
+
+// ldapSearch runs a subtree search and returns the matching entries
+func ldapSearch(conn *ldap.Conn, baseDN string, filter string, attributes []string) ([]*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, filter, attributes, nil)
+	result, err := conn.Search(req)
+	if err != nil {
+		// More than one match exceeds the size limit, which callers treat as ambiguous
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) && result != nil {
+			return result.Entries, nil
+		}
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// userAttributes lists the attributes read for a user entry
+func (cfg LDAPConfig) userAttributes() []string {
+	return []string{cfg.AttrUsername, cfg.AttrFullName, cfg.AttrEmail, cfg.AttrMemberOf}
+}
+
+// toEntry converts a directory entry using the configured attribute names
+func (cfg LDAPConfig) toEntry(e *ldap.Entry) *LDAPEntry {
+	return &LDAPEntry{
+		DN:       e.DN,
+		Username: e.GetEqualFoldAttributeValue(cfg.AttrUsername),
+		FullName: e.GetEqualFoldAttributeValue(cfg.AttrFullName),
+		Email:    e.GetEqualFoldAttributeValue(cfg.AttrEmail),
+		Groups:   e.GetEqualFoldAttributeValues(cfg.AttrMemberOf),
+	}
+}
+
+// parseGroupRoles parses "groupDN:role;groupDN:role" into a lookup of lower-cased DNs
+func parseGroupRoles(value string) map[string]string {
+	roles := map[string]string{}
+	for _, pair := range strings.Split(value, ";") {
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			continue
+		}
+		roles[strings.ToLower(strings.TrimSpace(pair[:i]))] = strings.TrimSpace(pair[i+1:])
+	}
+	return roles
+}
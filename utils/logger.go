@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// requestIDKey stores the request ID in a context.Context
+type requestIDKey struct{}
+
+// InitLogger installs the default slog logger. LOG_FORMAT selects "json"
+// (default) or "text" output and LOG_LEVEL one of debug, info, warn or error.
+// Calls to the standard log package go through the same handler.
+func InitLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(GetEnv("LOG_LEVEL", "info"))); err != nil {
+		log.Printf("Invalid LOG_LEVEL, using info: %v", err)
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.EqualFold(GetEnv("LOG_FORMAT", "json"), "text") {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// ContextWithRequestID returns a copy of ctx that carries the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or "" if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Logger returns the default logger, tagged with the request ID and trace ID
+// when ctx has them
+func Logger(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if ctx == nil {
+		return logger
+	}
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	if id := traceID(ctx); id != "" {
+		logger = logger.With("trace_id", id)
+	}
+	return logger
+}
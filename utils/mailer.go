@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailMessage is a plain-text email
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+// GetMailer returns the mailer selected by MAIL_DRIVER: "smtp", "file" or "log" (default)
+func GetMailer() Mailer {
+	switch GetEnv("MAIL_DRIVER", "log") {
+	case "smtp":
+		return SMTPMailer{
+			Host:     GetEnv("SMTP_HOST", "localhost"),
+			Port:     GetEnv("SMTP_PORT", "25"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     GetEnv("MAIL_FROM", "no-reply@localhost"),
+		}
+	case "file":
+		return FileMailer{
+			Path: GetEnv("MAIL_FILE", "mail.log"),
+			From: GetEnv("MAIL_FROM", "no-reply@localhost"),
+		}
+	default:
+		return LogMailer{}
+	}
+}
+
+// SMTPMailer sends mail through an SMTP server. STARTTLS is used automatically
+// when the server offers it; authentication is only attempted when Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Mailer
+func (m SMTPMailer) Send(msg MailMessage) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	err := smtp.SendMail(addr, auth, m.From, []string{msg.To}, formatMail(m.From, msg))
+	if err != nil {
+		return fmt.Errorf("error sending mail: %v", err)
+	}
+
+	return nil
+}
+
+// FileMailer appends each message to a file instead of sending it. Useful for
+// development and for test scripts that need to read the messages.
+type FileMailer struct {
+	Path string
+	From string
+}
+
+// fileMailerMu serializes writes so concurrent messages are not interleaved
+var fileMailerMu sync.Mutex
+
+// Send implements Mailer
+func (m FileMailer) Send(msg MailMessage) error {
+	fileMailerMu.Lock()
+	defer fileMailerMu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening mail file: %v", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(formatMail(m.From, msg), []byte("\r\n.\r\n")...))
+	if err != nil {
+		return fmt.Errorf("error writing mail file: %v", err)
+	}
+
+	return nil
+}
+
+// LogMailer writes messages to the application log instead of sending them
+type LogMailer struct{}
+
+// Send implements Mailer
+func (LogMailer) Send(msg MailMessage) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// formatMail renders a message with the headers required by RFC 5322
+func formatMail(from string, msg MailMessage) []byte {
+	// Strip line breaks from header values to prevent header injection
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	var b strings.Builder
+	b.WriteString("From: " + clean.Replace(from) + "\r\n")
+	b.WriteString("To: " + clean.Replace(msg.To) + "\r\n")
+	b.WriteString("Subject: " + clean.Replace(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// PasswordHasher hashes and verifies passwords using self-describing encoded hashes
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password
+	Hash(password string) (string, error)
+	// Verify reports whether password matches an encoded hash produced by this algorithm
+	Verify(password string, encoded string) (bool, error)
+	// NeedsRehash reports whether an encoded hash uses other parameters than this hasher
+	NeedsRehash(encoded string) bool
+}
+
+// GetPasswordHasher returns the hasher configured by environment variables
+func GetPasswordHasher() PasswordHasher {
+	if GetEnv("PASSWORD_HASH_ALGORITHM", HashArgon2id) == HashBcrypt {
+		return BcryptHasher{
+			Cost: GetEnvInt("BCRYPT_COST", bcrypt.DefaultCost),
+		}
+	}
+
+	return Argon2idHasher{
+		Memory:      uint32(GetEnvInt("ARGON2_MEMORY_KB", 64*1024)),
+		Iterations:  uint32(GetEnvInt("ARGON2_ITERATIONS", 3)),
+		Parallelism: uint8(GetEnvInt("ARGON2_PARALLELISM", 2)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// ValidatePasswordHasher checks the hashing parameters from the environment, so
+// a bad value stops startup instead of failing every hash at runtime
+func ValidatePasswordHasher() error {
+	switch algorithm := GetEnv("PASSWORD_HASH_ALGORITHM", HashArgon2id); algorithm {
+	case HashBcrypt:
+		cost := GetEnvInt("BCRYPT_COST", bcrypt.DefaultCost)
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("BCRYPT_COST must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cost)
+		}
+	case HashArgon2id:
+		iterations := GetEnvInt("ARGON2_ITERATIONS", 3)
+		parallelism := GetEnvInt("ARGON2_PARALLELISM", 2)
+		memory := GetEnvInt("ARGON2_MEMORY_KB", 64*1024)
+		if iterations < 1 {
+			return fmt.Errorf("ARGON2_ITERATIONS must be at least 1, got %d", iterations)
+		}
+		if parallelism < 1 || parallelism > 255 {
+			return fmt.Errorf("ARGON2_PARALLELISM must be between 1 and 255, got %d", parallelism)
+		}
+		if memory < 8*parallelism || int64(memory) > math.MaxUint32 {
+			return fmt.Errorf("ARGON2_MEMORY_KB must be between 8 x ARGON2_PARALLELISM (%d) and %d, got %d", 8*parallelism, uint32(math.MaxUint32), memory)
+		}
+	default:
+		return fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM %q", algorithm)
+	}
+
+	return nil
+}
+
+// HashPassword hashes a password with the configured hasher
+func HashPassword(ctx context.Context, password string) (string, error) {
+	hasher := GetPasswordHasher()
+	algorithm := HashArgon2id
+	if _, ok := hasher.(BcryptHasher); ok {
+		algorithm = HashBcrypt
+	}
+	defer instrumentPasswordHash(ctx, algorithm, "hash")()
+
+	return hasher.Hash(password)
+}
+
+// VerifyPassword checks a password against an encoded hash of any supported algorithm
+func VerifyPassword(ctx context.Context, password string, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		defer instrumentPasswordHash(ctx, HashArgon2id, "verify")()
+		return Argon2idHasher{}.Verify(password, encoded)
+	case isBcryptHash(encoded):
+		defer instrumentPasswordHash(ctx, HashBcrypt, "verify")()
+		return BcryptHasher{}.Verify(password, encoded)
+	default:
+		return false, fmt.Errorf("unsupported password hash format")
+	}
+}
+
+// instrumentPasswordHash starts a span for a hash or verify operation and returns
+// a function that ends it and records the duration
+func instrumentPasswordHash(ctx context.Context, algorithm string, operation string) func() {
+	start := time.Now()
+	_, span := Tracer.Start(ctx, "password."+operation,
+		trace.WithAttributes(attribute.String("password.algorithm", algorithm)))
+
+	return func() {
+		span.End()
+		passwordHashDuration.WithLabelValues(algorithm, operation).Observe(time.Since(start).Seconds())
+	}
+}
+
+// PasswordNeedsRehash reports whether an encoded hash should be replaced with one
+// produced by the configured hasher (weaker algorithm or outdated parameters)
+func PasswordNeedsRehash(encoded string) bool {
+	return GetPasswordHasher().NeedsRehash(encoded)
+}
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// argon2idParams holds the parameters decoded from a PHC string
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// Hash implements PasswordHasher
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("error generating salt: %v", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify implements PasswordHasher using the parameters stored in the hash
+func (h Argon2idHasher) Verify(password string, encoded string) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// NeedsRehash implements PasswordHasher
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.Memory ||
+		params.iterations != h.Iterations ||
+		params.parallelism != h.Parallelism ||
+		uint32(len(params.salt)) != h.SaltLength ||
+		uint32(len(params.key)) != h.KeyLength
+}
+
+// decodeArgon2id parses an argon2id PHC string
+func decodeArgon2id(encoded string) (*argon2idParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version")
+	}
+
+	var params argon2idParams
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+	// argon2 panics on these rather than returning an error
+	if params.iterations < 1 || params.parallelism < 1 {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid argon2id hash: %v", err)
+	}
+
+	return &params, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. Its modular crypt format
+// ($2a$<cost>$<salt+hash>) is already self-describing.
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash implements PasswordHasher
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %v", err)
+	}
+	return string(hashed), nil
+}
+
+// Verify implements PasswordHasher
+func (h BcryptHasher) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error verifying password: %v", err)
+	}
+	return true, nil
+}
+
+// NeedsRehash implements PasswordHasher
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	if !isBcryptHash(encoded) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// isBcryptHash reports whether encoded looks like a bcrypt hash
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords is the bundled list of passwords that are always rejected
+var commonPasswords = loadCommonPasswords(commonPasswordsFile)
+
+// PasswordPolicy describes the rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength        int
+	MaxBytes         int // bcrypt ignores everything after 72 bytes
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUserInfo bool
+	RejectCommon     bool
+	BreachedMinCount int // reject passwords seen this many times in the breach corpus, 0 to disable
+}
+
+// PasswordViolation describes a single failed password rule
+type PasswordViolation struct {
+	Rule    string `json:"rule" example:"min_length"`
+	Message string `json:"message" example:"Password must be at least 8 characters long"`
+}
+
+// GetPasswordPolicy reads the password policy from environment variables
+func GetPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:        GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		MaxBytes:         GetEnvInt("PASSWORD_MAX_BYTES", 72),
+		RequireUpper:     GetEnvBool("PASSWORD_REQUIRE_UPPER", false),
+		RequireLower:     GetEnvBool("PASSWORD_REQUIRE_LOWER", true),
+		RequireDigit:     GetEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol:    GetEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		DisallowUserInfo: GetEnvBool("PASSWORD_DISALLOW_USER_INFO", true),
+		RejectCommon:     GetEnvBool("PASSWORD_REJECT_COMMON", true),
+		BreachedMinCount: GetEnvInt("BREACHED_PASSWORD_MIN_COUNT", 1),
+	}
+
+	// Never allow passwords that bcrypt would silently truncate
+	if policy.MaxBytes <= 0 || policy.MaxBytes > 72 {
+		policy.MaxBytes = 72
+	}
+
+	return policy
+}
+
+// ValidatePasswordPolicy checks a password against the configured policy
+func ValidatePasswordPolicy(password string, username string, fullName string) []PasswordViolation {
+	return GetPasswordPolicy().Validate(password, username, fullName)
+}
+
+// Validate checks a password against every rule of the policy and returns all violations.
+// The username and full name are used to reject passwords built from the user's own details.
+func (p PasswordPolicy) Validate(password string, username string, fullName string) []PasswordViolation {
+	violations := []PasswordViolation{}
+	add := func(rule string, message string) {
+		violations = append(violations, PasswordViolation{Rule: rule, Message: message})
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		add("min_length", fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > p.MaxBytes {
+		add("max_length", fmt.Sprintf("Password must be at most %d bytes long", p.MaxBytes))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		add("uppercase", "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		add("lowercase", "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add("digit", "Password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add("symbol", "Password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if p.DisallowUserInfo && containsUserInfo(lowered, username, fullName) {
+		add("user_info", "Password must not contain your username or name")
+	}
+	if p.RejectCommon && commonPasswords[lowered] {
+		add("common", "Password is too common")
+	}
+	if p.BreachedMinCount > 0 && BreachedPasswordCount(password) >= p.BreachedMinCount {
+		add("breached", "Password has appeared in a known data breach")
+	}
+
+	return violations
+}
+
+// containsUserInfo reports whether a lowercased password contains the username,
+// the full name or any meaningful part of the full name
+func containsUserInfo(password string, username string, fullName string) bool {
+	candidates := []string{username, strings.ReplaceAll(fullName, " ", "")}
+	candidates = append(candidates, strings.Fields(fullName)...)
+
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(candidate)
+		// Very short fragments match too many unrelated passwords
+		if len([]rune(candidate)) < 3 {
+			continue
+		}
+		if strings.Contains(password, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadCommonPasswords parses the bundled list, skipping blank lines and comments
+func loadCommonPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+
+	return passwords
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// GeneratePKCE returns a new RFC 7636 code verifier and its S256 code challenge
+func GeneratePKCE() (string, string, error) {
+	verifier, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, pkceChallenge(verifier), nil
+}
+
+// VerifyPKCE checks an RFC 7636 code verifier against an S256 code challenge
+func VerifyPKCE(verifier string, challenge string) bool {
+	// Verifiers must be 43-128 characters long
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	expected := pkceChallenge(verifier)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// pkceChallenge returns the S256 code challenge for a verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// shuttingDown is set once graceful shutdown begins
+var shuttingDown atomic.Bool
+
+// NewHTTPServer creates an HTTP server for the handler with timeouts and header
+// limits read from environment variables. Unlike http.ListenAndServe, slow or
+// idle clients cannot hold connections open forever.
+func NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       GetEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: GetEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      GetEnvDuration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       GetEnvDuration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		MaxHeaderBytes:    GetEnvInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+	}
+}
+
+// BeginShutdown marks the process as shutting down, so the readiness probe
+// fails and load balancers stop sending new traffic
+func BeginShutdown() {
+	shuttingDown.Store(true)
+}
+
+// ShuttingDown reports whether graceful shutdown has begun
+func ShuttingDown() bool {
+	return shuttingDown.Load()
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GetTLSConfig builds the server TLS settings from environment variables. It
+// returns nil when TLS is disabled, which is the case unless TLS_CERT_FILE and
+// TLS_KEY_FILE are set or TLS_SELF_SIGNED is true.
+func GetTLSConfig() (*tls.Config, error) {
+	certFile := GetEnv("TLS_CERT_FILE", "")
+	keyFile := GetEnv("TLS_KEY_FILE", "")
+	selfSigned := GetEnvBool("TLS_SELF_SIGNED", false)
+	if certFile == "" && keyFile == "" && !selfSigned {
+		return nil, nil
+	}
+
+	minVersion, err := parseTLSVersion(GetEnv("TLS_MIN_VERSION", "1.2"))
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(GetEnv("TLS_CIPHER_SUITES", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites, // only applies to TLS 1.2; Go picks TLS 1.3 suites itself
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		reloader, err := NewCertReloader(certFile, keyFile, GetEnvDuration("TLS_RELOAD_INTERVAL", 30*time.Second))
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+		return config, nil
+	}
+
+	// Development only: browsers and clients will warn about the untrusted certificate
+	hosts := strings.Split(GetEnv("TLS_SELF_SIGNED_HOSTS", "localhost,127.0.0.1,::1"), ",")
+	cert, err := GenerateSelfSignedCertificate(hosts, 365*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	log.Printf("Warning: serving a self-signed certificate for %s (SHA-256 %s); do not use in production",
+		strings.Join(hosts, ", "), hex.EncodeToString(sum[:]))
+	config.Certificates = []tls.Certificate{*cert}
+
+	return config, nil
+}
+
+// CertReloader serves a certificate and key from disk and picks up new files,
+// for example after a renewal, without restarting the server
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader loads a certificate and key pair. The files are checked for
+// changes at most once per interval, when a TLS handshake needs the certificate.
+func NewCertReloader(certFile string, keyFile string, interval time.Duration) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first when the
+// files have changed. It is meant for tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= r.interval {
+		r.checkedAt = time.Now()
+		if r.changed() {
+			// Keep serving the old certificate if the new files are unreadable or half written
+			if err := r.reload(); err != nil {
+				log.Printf("Failed to reload TLS certificate, keeping the previous one: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+	}
+
+	return r.cert, nil
+}
+
+// changed reports whether either file was modified since it was loaded
+func (r *CertReloader) changed() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(r.certMod) || !keyInfo.ModTime().Equal(r.keyMod)
+}
+
+// reload reads the certificate and key and records their modification times
+func (r *CertReloader) reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("error reading TLS certificate: %v", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error reading TLS key: %v", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %v", err)
+	}
+
+	r.cert = &cert
+	r.certMod = certInfo.ModTime()
+	r.keyMod = keyInfo.ModTime()
+	r.checkedAt = time.Now()
+	return nil
+}
+
+// GenerateSelfSignedCertificate creates an in-memory ECDSA certificate for the
+// given host names and IP addresses
+func GenerateSelfSignedCertificate(hosts []string, validFor time.Duration) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating TLS key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate serial number: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Simple RESTful API (development)"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %v", err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// NewRedirectServer creates a plain HTTP server that sends every request to the
+// same host and path over HTTPS on httpsPort
+func NewRedirectServer(addr string, httpsPort string) *http.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 literal
+		}
+		if httpsPort != "443" {
+			host += ":" + httpsPort
+		}
+
+		// 308 keeps the method and body, unlike 301
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+
+	return NewHTTPServer(addr, handler)
+}
+
+// parseTLSVersion converts "1.2" or "1.3" to a tls version constant
+func parseTLSVersion(value string) (uint16, error) {
+	switch strings.TrimSpace(value) {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS_MIN_VERSION %q (use 1.2 or 1.3)", value)
+}
+
+// parseCipherSuites converts a comma-separated list of cipher suite names, such
+// as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, to their IDs. Only suites Go
+// considers secure are accepted. An empty list keeps Go's defaults.
+func parseCipherSuites(value string) ([]uint16, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q in TLS_CIPHER_SUITES", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -23,26 +24,144 @@ func getJWTSecret() []byte {
 	return []byte(secret)
 }
 
+// AccessTokenTTL is how long access tokens (and their sessions) stay valid
+const AccessTokenTTL = 24 * time.Hour
+
+// Token purposes for short-lived tokens that must not be used as access tokens
+const (
+	PurposeMFA         = "mfa"
+	PurposeVerifyEmail = "verify_email"
+)
+
 // Claims structure for JWT
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Email     string `json:"email,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"` // set for tokens issued through OAuth
+	Scope     string `json:"scope,omitempty"`     // space-separated OAuth scopes
+	Purpose   string `json:"purpose,omitempty"`   // empty for access tokens
+	Actor     *Actor `json:"act,omitempty"`       // set while an admin impersonates the user
 	jwt.StandardClaims
 }
 
-// GenerateToken creates a new JWT token for the user
-func GenerateToken(userID int, username string) (string, error) {
+// Actor identifies the admin acting on behalf of the token's user
+type Actor struct {
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"` // the admin's own login session
+}
+
+// GenerateToken creates a new JWT token for the user, tied to a login session
+func GenerateToken(userID int, username string, role string, sessionID string) (string, error) {
 	// Create claims with user data and expiration time (24 hours)
+	claims := &Claims{
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "simple-restful-api",
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateOAuthToken creates an access token issued to an OAuth client, limited
+// to the granted scopes. userID is 0 and sessionID empty for client credentials.
+func GenerateOAuthToken(userID int, username string, role string, sessionID string, clientID string, scopes []string, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
+		ClientID:  clientID,
+		Scope:     strings.Join(scopes, " "),
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "simple-restful-api",
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateImpersonationToken creates a short-lived access token for a user that
+// carries the admin acting on their behalf in the act claim
+func GenerateImpersonationToken(userID int, username string, role string, sessionID string, actor Actor, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
+		Actor:     &actor,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "simple-restful-api",
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateMFAToken creates a short-lived token proving that the password step
+// of a two-step login succeeded. It cannot be used as an access token.
+func GenerateMFAToken(userID int, username string) (string, error) {
 	claims := &Claims{
 		UserID:   userID,
 		Username: username,
+		Purpose:  PurposeMFA,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "simple-restful-api",
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateEmailVerificationToken creates a signed token that verifies the given
+// email address for a user. It is only valid while the user still has that address.
+func GenerateEmailVerificationToken(userID int, email string, ttl time.Duration) (string, error) {
+	claims := &Claims{
+		UserID:  userID,
+		Email:   email,
+		Purpose: PurposeVerifyEmail,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
 			IssuedAt:  time.Now().Unix(),
 			Issuer:    "simple-restful-api",
 		},
 	}
 
+	return signClaims(claims)
+}
+
+// ValidateToken validates and parses a JWT access token
+func ValidateToken(tokenString string) (*Claims, error) {
+	return validateTokenPurpose(tokenString, "")
+}
+
+// ValidateMFAToken validates and parses an MFA challenge token
+func ValidateMFAToken(tokenString string) (*Claims, error) {
+	return validateTokenPurpose(tokenString, PurposeMFA)
+}
+
+// ValidateEmailVerificationToken validates and parses an email verification token
+func ValidateEmailVerificationToken(tokenString string) (*Claims, error) {
+	return validateTokenPurpose(tokenString, PurposeVerifyEmail)
+}
+
+// signClaims signs claims with the JWT secret
+func signClaims(claims *Claims) (string, error) {
 	// Create token with claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -55,8 +174,8 @@ func GenerateToken(userID int, username string) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken validates and parses a JWT token
-func ValidateToken(tokenString string) (*Claims, error) {
+// validateTokenPurpose parses a token and checks that it was issued for the given purpose
+func validateTokenPurpose(tokenString string, purpose string) (*Claims, error) {
 	// Parse token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
@@ -71,11 +190,16 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	// Validate token and extract claims
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("token was not issued for this purpose")
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	return claims, nil
 }
 
 // ExtractTokenFromHeader extracts Bearer token from Authorization header
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X simple-restful-api/utils.Version=1.2.0 -X simple-restful-api/utils.Commit=$(git rev-parse HEAD) -X simple-restful-api/utils.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Commit and BuildTime fall back to the VCS information Go embeds in the binary.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version" example:"1.2.0"`
+	Commit    string `json:"commit,omitempty" example:"e28b81e0c3f1"`
+	BuildTime string `json:"build_time,omitempty" example:"2024-05-01T10:00:00Z"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version" example:"go1.21.0"`
+}
+
+// GetBuildInfo returns the version, commit and build time of the binary
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	return info
+}